@@ -0,0 +1,90 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// Baseline records every available migration up to and including the
+// target migration as applied without executing any of them, and returns the
+// recorded ones.
+//
+// Baseline suits databases whose schema already exists when adopting
+// migrathor. The history table is created if it doesn't exist yet, but must
+// not contain any entries. The target is resolved like the target of
+// ApplyTo. Repeatable migrations are never baselined and run with the next
+// Apply.
+func (m *Migration) Baseline(ctx context.Context, db *sql.DB, upTo string) (baselined []string, err error) {
+	if upTo == "" {
+		return []string{}, fmt.Errorf("failed to baseline migrations: empty target migration")
+	}
+	baselined = []string{}
+	err = m.exclusive(ctx, db, func(conn *sql.Conn) error {
+		baselined, err = m.baseline(ctx, conn, upTo)
+		return err
+	})
+	return baselined, err
+}
+
+func (m *Migration) baseline(ctx context.Context, conn executor, upTo string) ([]string, error) {
+	if err := m.prepare(ctx, conn); err != nil {
+		return []string{}, err
+	}
+
+	run, available, err := m.snapshot()
+	if err != nil {
+		return []string{}, err
+	}
+
+	records, err := m.history(ctx, conn)
+	if err != nil {
+		return []string{}, err
+	}
+	if len(records) > 0 {
+		return []string{}, fmt.Errorf("failed to baseline migrations: history table %s already contains %d entries", m.historyTable(), len(records))
+	}
+
+	target, err := resolve(upTo, available)
+	if err != nil {
+		return []string{}, err
+	}
+	if repeatable(target) {
+		return []string{}, fmt.Errorf("failed to baseline migrations: target migration %q is repeatable", target)
+	}
+
+	migrations := versioned(available)
+	sort.Strings(migrations)
+	migrations = filter(migrations, func(s string) bool { return s <= target })
+
+	// checksums are recorded, so Verify detects later edits
+	steps := []Step{}
+	for _, migration := range migrations {
+		step := Step{Migration: migration}
+		if _, ok := m.registeredFunc(migration); !ok {
+			buf, err := run.read(migration)
+			if err != nil {
+				return []string{}, err
+			}
+			if step.file, err = run.file(migration); err != nil {
+				return []string{}, err
+			}
+			step.checksum = checksum(buf)
+		}
+		steps = append(steps, step)
+	}
+
+	err = transaction(ctx, conn, m.logger, func(tx *sql.Tx) error {
+		for _, step := range steps {
+			if err := m.record(ctx, tx, step, KindBaseline, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []string{}, err
+	}
+	return migrations, nil
+}
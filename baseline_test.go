@@ -0,0 +1,63 @@
+package migrathor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMigration_Baseline(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+	if _, err := migration.Baseline(ctx, database, ""); err == nil {
+		t.Error("Baseline() should fail without target")
+	}
+
+	got, err := migration.Baseline(ctx, database, "2019_03_05_173612")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Baseline()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Kind != KindBaseline || records[0].Checksum == "" {
+		t.Errorf("History() should contain a single baselined entry with checksum, got %v", records)
+	}
+
+	// baselined migrations were not executed: the users table doesn't exist
+	var exist bool
+	if err := database.QueryRowContext(ctx, `SELECT to_regclass('users') IS NOT NULL;`).Scan(&exist); err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Error("Baseline() executed SQL of baselined migration")
+	}
+
+	if _, err := migration.Baseline(ctx, database, "2019_03_05_213554"); err == nil {
+		t.Error("Baseline() should fail with existing history entries")
+	}
+
+	// the remaining migration depends on the users table
+	if _, err := database.ExecContext(ctx, `CREATE TABLE users (id SERIAL PRIMARY KEY, name TEXT, email TEXT, password TEXT);`); err != nil {
+		t.Fatal(err)
+	}
+	got, err = migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package migrathor
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+)
+
+// checksum returns the hex encoded SHA-256 sum of the migration contents.
+func checksum(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks whether every applied migration is still available and its
+// contents still match the checksum recorded at the time of execution.
+//
+// Verify returns a *MissingError listing every applied migration which isn't
+// available anymore (unless configured with WithIgnoreMissing) and a
+// *ChecksumError listing every edited migration. Migrations applied before
+// checksums were introduced and repeatable migrations are skipped. Verify is
+// read-only.
+func (m *Migration) Verify(ctx context.Context, db *sql.DB) error {
+	run, available, err := m.snapshot()
+	if err != nil {
+		return err
+	}
+
+	records, err := m.historyIfExists(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	return run.verify(available, records)
+}
+
+// verify checks the applied migrations for missing files and compares the
+// recorded checksums with the checksums of the available migrations.
+func (m *Migration) verify(available []string, records []Record) error {
+	// Were applied migrations deleted or renamed?
+	if missing := filterExcept(names(records), available); len(missing) > 0 && !m.ignoreMissing {
+		return &MissingError{missing}
+	}
+
+	modified := []string{}
+	for _, r := range records {
+		if r.Checksum == "" {
+			continue // applied before checksums were recorded
+		}
+		if repeatable(r.Migration) {
+			continue // executed again on changes
+		}
+		for _, migration := range available {
+			if strings.ToLower(migration) != strings.ToLower(r.Migration) {
+				continue
+			}
+			buf, err := m.read(migration)
+			if err != nil {
+				return err
+			}
+			if checksum(buf) != r.Checksum {
+				modified = append(modified, r.Migration)
+			}
+		}
+	}
+
+	if len(modified) > 0 {
+		return &ChecksumError{modified}
+	}
+	return nil
+}
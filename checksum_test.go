@@ -0,0 +1,140 @@
+package migrathor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_checksum(t *testing.T) {
+	got := checksum([]byte("CREATE TABLE users();"))
+	want := "21e2ca20f79f2cf0e0dc3533e5bc2aee2dc96c2c72e9a318409a94753317461f"
+	if got != want {
+		t.Errorf("checksum()\ngot  %s\nwant %s\n", got, want)
+	}
+}
+
+func TestMigration_Verify(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := time.Now().Format(defaultTimestampFormat + "_create_log.sql")
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(`CREATE TABLE log (id bigserial PRIMARY KEY);`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	migration := New(dir)
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.Verify(ctx, database); err != nil {
+		t.Fatalf("Verify() returned error for unmodified migrations: %v", err)
+	}
+
+	// edit applied migration
+	if err := ioutil.WriteFile(file, []byte(`CREATE TABLE log (id bigserial PRIMARY KEY, msg TEXT);`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = migration.Verify(ctx, database)
+	cerr, ok := err.(*ChecksumError)
+	if !ok {
+		t.Fatalf("Verify() should return *ChecksumError, got %v", err)
+	}
+	if want := []string{name}; !reflect.DeepEqual(cerr.Migrations, want) {
+		t.Errorf("Verify()\ngot  %v\nwant %v\n", cerr.Migrations, want)
+	}
+	if _, err := migration.Apply(ctx, database); err == nil {
+		t.Error("Apply() should refuse to run with modified migrations")
+	}
+}
+
+func TestMigration_upgrade(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	// history table as created by earlier versions
+	cmd := `
+CREATE TABLE users (id serial PRIMARY KEY, email TEXT NOT NULL, name TEXT NOT NULL);
+CREATE TABLE migrations (
+	id integer PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	migration TEXT NOT NULL UNIQUE,
+	applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	execution_time REAL NOT NULL
+);
+INSERT INTO migrations (migration, execution_time) VALUES ('2019_03_05_173612_create_users.sql', 0);`
+	if _, err := database.ExecContext(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	migration := New("testdata")
+	if err := migration.Verify(ctx, database); err != nil {
+		t.Fatalf("Verify() should skip migrations without checksum: %v", err)
+	}
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestMigration_VerifyMissing(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := "2019_03_06_000000_create_log.sql"
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(`CREATE TABLE log ();`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(dir).Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	// delete applied migration
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	err = New(dir).Verify(ctx, database)
+	merr, ok := err.(*MissingError)
+	if !ok {
+		t.Fatalf("Verify() should return *MissingError, got %v", err)
+	}
+	if want := []string{name}; !reflect.DeepEqual(merr.Migrations, want) {
+		t.Errorf("MissingError.Migrations\ngot  %v\nwant %v\n", merr.Migrations, want)
+	}
+	if _, err := New(dir).Apply(ctx, database); err == nil {
+		t.Error("Apply() should refuse to run with missing migrations")
+	}
+	if _, err := New(dir, WithIgnoreMissing(true)).Apply(ctx, database); err != nil {
+		t.Errorf("Apply() should ignore missing migrations: %v", err)
+	}
+}
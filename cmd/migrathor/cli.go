@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/denisbrodbeck/migrathor"
@@ -26,20 +29,43 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 		fs.Output().Write([]byte(usage))
 	}
 	var (
-		flagPath        = fs.String("path", "migrations", "the path to the migrations files to be executed")
-		flagTable       = fs.String("table", "migrations", "name of applied migrations history table")
-		flagHost        = fs.String("host", "localhost", "database host")
-		flagPort        = fs.String("port", "5432", "database port")
-		flagName        = fs.String("name", "postgres", "database name")
-		flagUser        = fs.String("user", "postgres", "database user")
-		flagPass        = fs.String("pass", "", "database password")
-		flagTimeout     = fs.Duration("timeout", time.Second*10, "connection timeout in seconds (default 10s)")
-		flagSSLMode     = fs.String("sslmode", "disable", "database SSL mode (see options)")
-		flagSSLCert     = fs.String("sslcert", "", "PEM encoded cert file location")
-		flagSSLKey      = fs.String("sslkey", "", "PEM encoded key file location")
-		flagSSLRootCert = fs.String("sslrootcert", "", "PEM encoded root certificate file location")
+		flagPath          = fs.String("path", "migrations", "the path to the migrations files to be executed")
+		flagRecursive     = fs.Bool("recursive", false, "search subdirectories of -path for migration files as well")
+		flagTable         = fs.String("table", "migrations", "name of applied migrations history table (may be schema-qualified)")
+		flagSchema        = fs.String("schema", "", "target schema of migrations and history table")
+		flagLockTimeout   = fs.Duration("lock-timeout", time.Minute, "max time to wait for the migration lock of concurrent runs")
+		flagHost          = fs.String("host", "localhost", "database host")
+		flagPort          = fs.String("port", "5432", "database port")
+		flagName          = fs.String("name", "postgres", "database name")
+		flagUser          = fs.String("user", "postgres", "database user")
+		flagPass          = fs.String("pass", "", "database password")
+		flagTimeout       = fs.Duration("timeout", time.Second*10, "connection timeout in seconds (default 10s)")
+		flagSSLMode       = fs.String("sslmode", "disable", "database SSL mode (see options)")
+		flagSSLCert       = fs.String("sslcert", "", "PEM encoded cert file location")
+		flagSSLKey        = fs.String("sslkey", "", "PEM encoded key file location")
+		flagSSLRootCert   = fs.String("sslrootcert", "", "PEM encoded root certificate file location")
+		flagDryRun        = fs.Bool("dry-run", false, "print pending migrations without applying them")
+		flagShowSQL       = fs.Bool("show-sql", false, "print the SQL of pending migrations in dry-run mode")
+		flagTo            = fs.String("to", "", "apply pending migrations up to and including this migration")
+		flagSteps         = fs.Int("steps", 0, "apply only the next n pending migrations")
+		flagOutOfOrder    = fs.Bool("allow-out-of-order", false, "apply pending migrations older than the latest applied migration")
+		flagIgnoreMissing = fs.Bool("ignore-missing", false, "ignore applied migrations whose files are missing")
+		flagDeploymentID  = fs.String("deployment-id", "", "identifier of the current deployment recorded in the history table")
+		flagAtomic        = fs.Bool("atomic", false, "apply all pending migrations in a single transaction")
+		flagForce         = fs.Bool("force", false, "allow mark-applied, unmark and resolve on production-looking databases")
+		flagVars          = envVariables(os.Environ())
+		flagTags          = tags{}
 	)
+	fs.Var(&flagTags, "tags", "select migrations by tags, e.g. prod or !seed (comma-separated)")
+	fs.Var(flagVars, "var", "variable substituted in migration files as key=value (repeatable)")
 	err := ff.Parse(fs, args, ff.WithEnvVarPrefix("MIGRATHOR"))
+	if err == nil {
+		// flags may follow the command as well: migrathor migrate -dry-run
+		err = parseInterspersed(fs)
+	}
+	if err == nil && *flagTo != "" && *flagSteps != 0 {
+		err = fmt.Errorf("flags -to and -steps are mutually exclusive")
+	}
 	if err != nil {
 		if err != flag.ErrHelp {
 			fs.Output().Write([]byte(fmt.Sprintf("\nUsage error: %s\n", err)))
@@ -48,7 +74,27 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 	}
 
 	// wire up miration with user-provided migration table und connect library logger to stdout
-	migration := migrathor.New(*flagPath, migrathor.WithHistoryTable(*flagTable), migrathor.WithLogger(out.Print))
+	options := []migrathor.Option{
+		migrathor.WithHistoryTable(*flagTable),
+		migrathor.WithSchema(*flagSchema),
+		migrathor.WithLockTimeout(*flagLockTimeout),
+		migrathor.WithAllowOutOfOrder(*flagOutOfOrder),
+		migrathor.WithIgnoreMissing(*flagIgnoreMissing),
+		migrathor.WithVersion(gitTag),
+		migrathor.WithDeploymentID(*flagDeploymentID),
+		migrathor.WithVariables(flagVars),
+		migrathor.WithTags(flagTags...),
+		migrathor.WithLogger(out.Print),
+	}
+	if *flagAtomic {
+		options = append(options, migrathor.WithSingleTransaction())
+	}
+	if *flagRecursive {
+		options = append(options, migrathor.WithRecursive())
+	}
+	migration := migrathor.New(*flagPath, options...)
+
+	dsn := createDSN(*flagHost, *flagPort, *flagName, *flagUser, *flagPass, *flagSSLMode, *flagSSLCert, *flagSSLKey, *flagSSLRootCert, *flagTimeout)
 
 	// parse commands
 	commands := fs.Args()
@@ -67,7 +113,7 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 			}
 			log.Printf("Created Migration: %s", path)
 		case "migrate":
-			db, err := connect(createDSN(*flagHost, *flagPort, *flagName, *flagUser, *flagPass, *flagSSLMode, *flagSSLCert, *flagSSLKey, *flagSSLRootCert, *flagTimeout))
+			db, err := connect(dsn)
 			if err != nil {
 				errlog.Println(err)
 				return 2
@@ -78,11 +124,40 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
 			defer cancelFunc()
 
-			applied, err := migration.Apply(ctx, db)
+			if *flagDryRun {
+				var steps []migrathor.Step
+				switch {
+				case *flagTo != "":
+					steps, err = migration.PlanTo(ctx, db, *flagTo)
+				case *flagSteps != 0:
+					steps, err = migration.PlanSteps(ctx, db, *flagSteps)
+				default:
+					steps, err = migration.Plan(ctx, db)
+				}
+				if err != nil {
+					errlog.Printf("failed to plan migrations: %v", err)
+					if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+						errlog.Println(formatPqError(pqerr, err))
+					}
+					return 3
+				}
+				printPlan(stdout, steps, *flagShowSQL)
+				return 0
+			}
+
+			var applied []string
+			switch {
+			case *flagTo != "":
+				applied, err = migration.ApplyTo(ctx, db, *flagTo)
+			case *flagSteps != 0:
+				applied, err = migration.ApplySteps(ctx, db, *flagSteps)
+			default:
+				applied, err = migration.Apply(ctx, db)
+			}
 			if err != nil {
 				errlog.Printf("failed to run migrations: %v", err)
 				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
-					errlog.Println(formatPqError(pqerr))
+					errlog.Println(formatPqError(pqerr, err))
 				}
 			}
 			if applied != nil && len(applied) > 0 {
@@ -91,6 +166,141 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 				}
 				out.Printf("Applied migrations: %d\n", len(applied))
 			}
+			if err != nil {
+				// migrations applied before the failure were reported above
+				return 3
+			}
+		case "baseline":
+			if *flagTo == "" {
+				errlog.Println("failed to baseline migrations: missing flag -to")
+				return 1
+			}
+			db, err := connect(dsn)
+			if err != nil {
+				errlog.Println(err)
+				return 2
+			}
+			defer logCloser(db, errlog)
+
+			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancelFunc()
+
+			baselined, err := migration.Baseline(ctx, db, *flagTo)
+			if err != nil {
+				errlog.Printf("failed to baseline migrations: %v", err)
+				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+					errlog.Println(formatPqError(pqerr, err))
+				}
+				return 3
+			}
+			for _, mig := range baselined {
+				out.Printf("baselined: %s\n", mig)
+			}
+			out.Printf("Baselined migrations: %d\n", len(baselined))
+		case "mark-applied", "unmark", "resolve":
+			command := strings.ToLower(commands[0])
+			if len(commands) < 2 {
+				errlog.Printf("failed to %s migration: missing migration file", command)
+				return 1
+			}
+			resolveApplied := false
+			if command == "resolve" {
+				if len(commands) < 3 || (commands[2] != "applied" && commands[2] != "pending") {
+					errlog.Println("failed to resolve migration: state must be either applied or pending")
+					return 1
+				}
+				resolveApplied = commands[2] == "applied"
+			}
+			if productionLike(*flagHost, *flagName) && !*flagForce {
+				errlog.Printf("refusing to %s migration on production-looking database %s/%s: use -force", command, *flagHost, *flagName)
+				return 1
+			}
+			db, err := connect(dsn)
+			if err != nil {
+				errlog.Println(err)
+				return 2
+			}
+			defer logCloser(db, errlog)
+
+			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancelFunc()
+
+			var mig string
+			switch command {
+			case "mark-applied":
+				mig, err = migration.MarkApplied(ctx, db, commands[1])
+			case "unmark":
+				mig, err = migration.Unmark(ctx, db, commands[1])
+			case "resolve":
+				mig, err = migration.Resolve(ctx, db, commands[1], resolveApplied)
+			}
+			if err != nil {
+				errlog.Printf("failed to %s migration: %v", command, err)
+				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+					errlog.Println(formatPqError(pqerr, err))
+				}
+				return 3
+			}
+			out.Printf("%s: %s\n", command, mig)
+		case "status":
+			db, err := connect(dsn)
+			if err != nil {
+				errlog.Println(err)
+				return 2
+			}
+			defer logCloser(db, errlog)
+
+			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancelFunc()
+
+			status, err := migration.Status(ctx, db)
+			if err != nil {
+				errlog.Printf("failed to get migration status: %v", err)
+				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+					errlog.Println(formatPqError(pqerr, err))
+				}
+				return 3
+			}
+			printStatus(stdout, status)
+		case "history":
+			db, err := connect(dsn)
+			if err != nil {
+				errlog.Println(err)
+				return 2
+			}
+			defer logCloser(db, errlog)
+
+			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancelFunc()
+
+			records, err := migration.History(ctx, db)
+			if err != nil {
+				errlog.Printf("failed to get migration history: %v", err)
+				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+					errlog.Println(formatPqError(pqerr, err))
+				}
+				return 3
+			}
+			printHistory(stdout, records)
+		case "verify":
+			db, err := connect(dsn)
+			if err != nil {
+				errlog.Println(err)
+				return 2
+			}
+			defer logCloser(db, errlog)
+
+			ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute*5)
+			defer cancelFunc()
+
+			if err := migration.Verify(ctx, db); err != nil {
+				errlog.Printf("failed to verify migrations: %v", err)
+				if pqerr := migrathor.UnderlyingError(err); pqerr != err {
+					errlog.Println(formatPqError(pqerr, err))
+				}
+				return 3
+			}
+			out.Println("All applied migrations match their files.")
 		case "version":
 			out.Println(gitTag)
 		}
@@ -99,6 +309,161 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 	return 0
 }
 
+// parseInterspersed continues parsing flags which follow positional arguments.
+//
+// The flag package stops parsing at the first non-flag argument. The
+// remaining flags are parsed and the positional arguments are kept in order,
+// so fs.Args() returns positional arguments only.
+func parseInterspersed(fs *flag.FlagSet) error {
+	positional := []string{}
+	for args := fs.Args(); len(args) > 0; args = fs.Args() {
+		positional = append(positional, args[0])
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// variables collects -var flags of the form key=value.
+type variables map[string]string
+
+func (v variables) String() string {
+	pairs := []string{}
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v variables) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("variable %q must be of the form key=value", s)
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// tags collects comma-separated -tags flags.
+type tags []string
+
+func (t *tags) String() string { return strings.Join(*t, ",") }
+
+func (t *tags) Set(s string) error {
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+	return nil
+}
+
+// envVariables returns the variables defined by MIGRATHOR_VAR_* environment
+// variables, e.g. MIGRATHOR_VAR_APP_ROLE=app defines app_role. Values of -var
+// flags take precedence.
+func envVariables(environ []string) variables {
+	const prefix = "MIGRATHOR_VAR_"
+	v := variables{}
+	for _, env := range environ {
+		i := strings.Index(env, "=")
+		if i <= len(prefix) || !strings.HasPrefix(env, prefix) {
+			continue
+		}
+		v[strings.ToLower(env[len(prefix):i])] = env[i+1:]
+	}
+	return v
+}
+
+// printPlan writes the execution plan of pending migrations.
+func printPlan(w io.Writer, steps []migrathor.Step, showSQL bool) {
+	fmt.Fprintf(w, "Pending migrations: %d\n", len(steps))
+	for i, step := range steps {
+		mode := "transaction"
+		if !step.Transaction {
+			mode = "no transaction"
+		}
+		fmt.Fprintf(w, "%d. %s (%s)\n", i+1, step.Migration, mode)
+		if showSQL && step.SQL != "" {
+			fmt.Fprintf(w, "\n%s\n\n", strings.TrimSpace(step.SQL))
+		}
+	}
+}
+
+// printStatus writes the migration status as table followed by a short summary.
+func printStatus(w io.Writer, status []migrathor.MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tSTATE\tAPPLIED AT\tEXECUTION TIME")
+
+	counts := map[migrathor.State]int{}
+	for _, s := range status {
+		counts[s.State]++
+		state := s.State.String()
+		if s.OutOfOrder {
+			state += " (out of order)"
+		}
+		appliedAt, executionTime := "-", "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+			executionTime = s.ExecutionTime.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Migration, state, appliedAt, executionTime)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nApplied: %d, Pending: %d, Missing: %d",
+		counts[migrathor.StateApplied], counts[migrathor.StatePending], counts[migrathor.StateMissing])
+	if counts[migrathor.StateSkipped] > 0 {
+		fmt.Fprintf(w, ", Skipped: %d", counts[migrathor.StateSkipped])
+	}
+	if counts[migrathor.StateDirty] > 0 {
+		fmt.Fprintf(w, ", Dirty: %d (see resolve)", counts[migrathor.StateDirty])
+	}
+	fmt.Fprintln(w)
+}
+
+// printHistory writes the entries of the history table as table.
+func printHistory(w io.Writer, records []migrathor.Record) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tKIND\tAPPLIED AT\tEXECUTION TIME\tAPPLIED BY\tAPPLICATION\tHOSTNAME\tVERSION\tDEPLOYMENT\tTAGS")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Migration,
+			orDash(string(r.Kind)),
+			r.AppliedAt.Format(time.RFC3339),
+			r.ExecutionTime,
+			orDash(r.AppliedBy),
+			orDash(r.ApplicationName),
+			orDash(r.Hostname),
+			orDash(r.Version),
+			orDash(r.DeploymentID),
+			orDash(strings.Join(r.Tags, ",")),
+		)
+	}
+	tw.Flush()
+}
+
+// productionLike returns whether the database host or name looks like a
+// production database, e.g. db.prod.example.com or app_prd.
+func productionLike(host, name string) bool {
+	for _, s := range []string{host, name} {
+		s = strings.ToLower(s)
+		if strings.Contains(s, "prod") || strings.Contains(s, "prd") {
+			return true
+		}
+	}
+	return false
+}
+
+// orDash returns s or "-" if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func createDSN(host, port, name, user, pass, sslmode, sslcert, sslkey, sslrootcert string, timeout time.Duration) string {
 	dsn := ""
 	if host != "" {
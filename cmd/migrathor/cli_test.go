@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/denisbrodbeck/migrathor"
+
+	"github.com/lib/pq"
 )
 
 // just define this here so we can run go test ./... from package root without warnings
@@ -45,3 +50,192 @@ func Test_connect(t *testing.T) {
 	}
 	db.Close()
 }
+
+func Test_printStatus(t *testing.T) {
+	appliedAt := time.Date(2019, 3, 5, 17, 36, 12, 0, time.UTC)
+	status := []migrathor.MigrationStatus{
+		{Migration: "2019_03_05_173612_create_users.sql", State: migrathor.StateApplied, AppliedAt: appliedAt, ExecutionTime: time.Millisecond * 12},
+		{Migration: "2019_03_05_213554_add_users.sql", State: migrathor.StatePending},
+		{Migration: "2019_03_05_173000_create_log.sql", State: migrathor.StatePending, OutOfOrder: true},
+		{Migration: "2019_03_06_000000_seed_users.sql", State: migrathor.StateSkipped},
+	}
+	buf := &bytes.Buffer{}
+	printStatus(buf, status)
+
+	want := `
+MIGRATION                           STATE                   APPLIED AT            EXECUTION TIME
+2019_03_05_173612_create_users.sql  applied                 2019-03-05T17:36:12Z  12ms
+2019_03_05_213554_add_users.sql     pending                 -                     -
+2019_03_05_173000_create_log.sql    pending (out of order)  -                     -
+2019_03_06_000000_seed_users.sql    skipped                 -                     -
+
+Applied: 1, Pending: 2, Missing: 0, Skipped: 1
+`[1:]
+	if got := buf.String(); got != want {
+		t.Errorf("printStatus()\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_parseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	path := fs.String("path", "migrations", "")
+	dryRun := fs.Bool("dry-run", false, "")
+
+	if err := fs.Parse([]string{"-path", "db", "migrate", "-dry-run", "extra"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseInterspersed(fs); err != nil {
+		t.Fatal(err)
+	}
+	if *path != "db" || *dryRun != true {
+		t.Errorf("parseInterspersed() did not parse flags: path=%q dry-run=%t", *path, *dryRun)
+	}
+	want := []string{"migrate", "extra"}
+	if got := fs.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseInterspersed()\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func Test_printPlan(t *testing.T) {
+	steps := []migrathor.Step{
+		{Migration: "2019_03_05_173612_create_users.sql", Transaction: true, SQL: "CREATE TABLE users ();\n"},
+		{Migration: "2019_03_05_213554_add_users.sql", Transaction: false, SQL: "-- migrathor:no_transaction\nVACUUM users;"},
+	}
+	buf := &bytes.Buffer{}
+	printPlan(buf, steps, false)
+
+	want := `
+Pending migrations: 2
+1. 2019_03_05_173612_create_users.sql (transaction)
+2. 2019_03_05_213554_add_users.sql (no transaction)
+`[1:]
+	if got := buf.String(); got != want {
+		t.Errorf("printPlan()\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	printPlan(buf, steps[:1], true)
+	want = `
+Pending migrations: 1
+1. 2019_03_05_173612_create_users.sql (transaction)
+
+CREATE TABLE users ();
+
+`[1:]
+	if got := buf.String(); got != want {
+		t.Errorf("printPlan()\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_printHistory(t *testing.T) {
+	records := []migrathor.Record{
+		{
+			Migration:       "2019_03_05_173612_create_users.sql",
+			AppliedAt:       time.Date(2019, 3, 5, 17, 36, 12, 0, time.UTC),
+			ExecutionTime:   time.Millisecond * 12,
+			AppliedBy:       "postgres",
+			ApplicationName: "deploy",
+			Hostname:        "ci-runner",
+			Version:         "v1.0.0",
+			DeploymentID:    "42",
+			Kind:            migrathor.KindExecuted,
+			Tags:            []string{"prod", "!seed"},
+		},
+		{
+			Migration: "2019_03_05_213554_add_users.sql",
+			AppliedAt: time.Date(2019, 3, 5, 21, 35, 54, 0, time.UTC),
+			Kind:      migrathor.KindBaseline,
+		},
+	}
+	buf := &bytes.Buffer{}
+	printHistory(buf, records)
+
+	want := `
+MIGRATION                           KIND      APPLIED AT            EXECUTION TIME  APPLIED BY  APPLICATION  HOSTNAME   VERSION  DEPLOYMENT  TAGS
+2019_03_05_173612_create_users.sql  executed  2019-03-05T17:36:12Z  12ms            postgres    deploy       ci-runner  v1.0.0   42          prod,!seed
+2019_03_05_213554_add_users.sql     baseline  2019-03-05T21:35:54Z  0s              -           -            -          -        -           -
+`[1:]
+	if got := buf.String(); got != want {
+		t.Errorf("printHistory()\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_variables(t *testing.T) {
+	vars := envVariables([]string{
+		"HOME=/root",
+		"MIGRATHOR_VAR_APP_ROLE=app",
+		"MIGRATHOR_VAR_OWNER=admin",
+		"MIGRATHOR_VAR_=empty",
+		"MIGRATHOR_HOST=localhost",
+	})
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(vars, "var", "")
+	if err := fs.Parse([]string{"-var", "owner=root", "-var", "filter=a=b"}); err != nil {
+		t.Fatal(err)
+	}
+	want := variables{"app_role": "app", "owner": "root", "filter": "a=b"}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("variables\ngot  %v\nwant %v\n", vars, want)
+	}
+	if got, want := vars.String(), "app_role=app,filter=a=b,owner=root"; got != want {
+		t.Errorf("String()\ngot  %q\nwant %q\n", got, want)
+	}
+	if err := vars.Set("novalue"); err == nil {
+		t.Error("Set() should fail without =")
+	}
+}
+
+func Test_productionLike(t *testing.T) {
+	tests := []struct {
+		host, name string
+		want       bool
+	}{
+		{"localhost", "postgres", false},
+		{"db.staging.example.com", "app", false},
+		{"db.prod.example.com", "app", true},
+		{"localhost", "app_PRD", true},
+		{"production-db", "app", true},
+	}
+	for _, tt := range tests {
+		if got := productionLike(tt.host, tt.name); got != tt.want {
+			t.Errorf("productionLike(%q, %q) = %t, want %t", tt.host, tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_tags(t *testing.T) {
+	var got tags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&got, "tags", "")
+	if err := fs.Parse([]string{"-tags", "prod, !seed", "-tags", "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	want := tags{"prod", "!seed", "eu"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func Test_migrateFailure(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	args := []string{"-name", "postgres", "-user", "postgres", "-path", "doesnotexist", "migrate"}
+	if got := ParseAndRun(stdout, stderr, nil, args); got != 3 {
+		t.Errorf("ParseAndRun() = %d, want 3 for failed migrations\n%s", got, stderr)
+	}
+}
+
+func Test_formatPqError(t *testing.T) {
+	pqerr := &pq.Error{Severity: "ERROR", Code: "42601", Message: "syntax error at end of input", Position: "9"}
+
+	cause := error(&migrathor.DriverError{Info: "failed to execute Go migration 2019_03_06_120000_backfill_slugs", Err: pqerr})
+	if got := formatPqError(pqerr, cause); !strings.Contains(got, "Position   : 9\n") {
+		t.Errorf("formatPqError() should print the position of errors without location\n%s", got)
+	}
+	cause = &migrathor.MigrationError{Migration: "2019_03_05_173612_create_users.sql", Line: 1, Column: 9, Err: pqerr}
+	if got := formatPqError(pqerr, cause); strings.Contains(got, "Position") {
+		t.Errorf("formatPqError() should leave out the position of located errors\n%s", got)
+	}
+}
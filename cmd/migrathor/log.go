@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 
+	"github.com/denisbrodbeck/migrathor"
 	"github.com/lib/pq"
 )
 
@@ -14,7 +16,10 @@ func logCloser(c io.Closer, l *log.Logger) {
 	}
 }
 
-func formatPqError(err error) string {
+// formatPqError returns the details of a PostgreSQL error underlying cause.
+// The error position is left out if cause is a migrathor.MigrationError,
+// which located it within the migration file already.
+func formatPqError(err, cause error) string {
 	if e, ok := err.(*pq.Error); ok {
 		msg := fmt.Sprintf("Severity   : %s\n", e.Severity)
 		msg += fmt.Sprintf("Error Code : %s (%s)\n", e.Code, e.Code.Name())
@@ -25,7 +30,8 @@ func formatPqError(err error) string {
 		if e.Hint != "" {
 			msg += fmt.Sprintf("Hint       : %s\n", e.Hint)
 		}
-		if e.Position != "" {
+		var merr *migrathor.MigrationError
+		if e.Position != "" && !(errors.As(cause, &merr) && merr.Line > 0) {
 			msg += fmt.Sprintf("Position   : %s\n", e.Position)
 		}
 		return msg
@@ -8,24 +8,45 @@
 //
 // The commands are
 //
-// 	create     create a new migration file
-// 	migrate    run the database migrations
-// 	version    print migrathor version
+// 	create        create a new migration file
+// 	migrate       run the database migrations
+// 	baseline      record migrations up to -to as applied without executing them
+// 	mark-applied  record a migration file as applied without executing it (repair)
+// 	unmark        remove a migration file from the history table (repair)
+// 	resolve       mark a failed (dirty) migration as applied or pending again (repair)
+// 	status        show applied, pending and missing migrations
+// 	history       show the history of applied migrations
+// 	verify        check applied migrations for missing files and modifications
+// 	version       print migrathor version
 //
 // The arguments are
 //
-// 	-path         path to the migrations files to be executed (default migrations)
-// 	-table        name of applied migrations history table (default migrations)
-// 	-host         database hostname (default localhost)
-// 	-port         database port (default 5432)
-// 	-name         database name (default postgres)
-// 	-user         database user (default postgres)
-// 	-pass         database password (default empty)
-// 	-timeout      connection timeout in seconds (default 10s)
-// 	-sslmode      SSL mode (default disable - see [SSL modes])
-// 	-sslcert      PEM encoded cert file location
-// 	-sslkey       PEM encoded key file location
-// 	-sslrootcert  PEM encoded root certificate file location
+// 	-path                path to the migrations files to be executed (default migrations)
+// 	-recursive           search subdirectories of -path for migration files as well
+// 	-table               name of applied migrations history table, may be schema-qualified (default migrations)
+// 	-schema              target schema of migrations and history table (default current schema)
+// 	-lock-timeout        max time to wait for the migration lock of concurrent runs (default 1m)
+// 	-host                database hostname (default localhost)
+// 	-port                database port (default 5432)
+// 	-name                database name (default postgres)
+// 	-user                database user (default postgres)
+// 	-pass                database password (default empty)
+// 	-timeout             connection timeout in seconds (default 10s)
+// 	-sslmode             SSL mode (default disable - see [SSL modes])
+// 	-sslcert             PEM encoded cert file location
+// 	-sslkey              PEM encoded key file location
+// 	-sslrootcert         PEM encoded root certificate file location
+// 	-dry-run             print pending migrations without applying them
+// 	-show-sql            print the SQL of pending migrations in dry-run mode
+// 	-to                  apply (or baseline) migrations up to and including this migration (filename or prefix)
+// 	-steps               apply only the next n pending migrations
+// 	-allow-out-of-order  apply pending migrations older than the latest applied migration
+// 	-ignore-missing      ignore applied migrations whose files are missing
+// 	-deployment-id       identifier of the current deployment recorded in the history table
+// 	-atomic              apply all pending migrations in a single transaction
+// 	-var                 variable substituted in migration files as key=value (repeatable, env MIGRATHOR_VAR_<KEY>)
+// 	-tags                select migrations by their tags directive, e.g. prod or !seed (comma-separated)
+// 	-force               allow mark-applied, unmark and resolve on production-looking databases (host or name containing prod/prd)
 //
 // Available SSL modes
 //
@@ -50,24 +71,45 @@ Usage:
 
 The commands are:
 
-	create     create a new migration file
-	migrate    run the database migrations
-	version    print migrathor version
+	create        create a new migration file
+	migrate       run the database migrations
+	baseline      record migrations up to -to as applied without executing them
+	mark-applied  record a migration file as applied without executing it (repair)
+	unmark        remove a migration file from the history table (repair)
+	resolve       mark a failed (dirty) migration as applied or pending again (repair)
+	status        show applied, pending and missing migrations
+	history       show the history of applied migrations
+	verify        check applied migrations for missing files and modifications
+	version       print migrathor version
 
 The arguments are:
 
-	-path         path to the migrations files to be executed (default migrations)
-	-table        name of applied migrations history table (default migrations)
-	-host         database hostname (default localhost)
-	-port         database port (default 5432)
-	-name         database name (default postgres)
-	-user         database user (default postgres)
-	-pass         database password (default empty)
-	-timeout      connection timeout in seconds (default 10s)
-	-sslmode      SSL mode (default disable - see [SSL modes])
-	-sslcert      PEM encoded cert file location
-	-sslkey       PEM encoded key file location
-	-sslrootcert  PEM encoded root certificate file location
+	-path                path to the migrations files to be executed (default migrations)
+	-recursive           search subdirectories of -path for migration files as well
+	-table               name of applied migrations history table, may be schema-qualified (default migrations)
+	-schema              target schema of migrations and history table (default current schema)
+	-lock-timeout        max time to wait for the migration lock of concurrent runs (default 1m)
+	-host                database hostname (default localhost)
+	-port                database port (default 5432)
+	-name                database name (default postgres)
+	-user                database user (default postgres)
+	-pass                database password (default empty)
+	-timeout             connection timeout in seconds (default 10s)
+	-sslmode             SSL mode (default disable - see [SSL modes])
+	-sslcert             PEM encoded cert file location
+	-sslkey              PEM encoded key file location
+	-sslrootcert         PEM encoded root certificate file location
+	-dry-run             print pending migrations without applying them
+	-show-sql            print the SQL of pending migrations in dry-run mode
+	-to                  apply (or baseline) migrations up to and including this migration (filename or prefix)
+	-steps               apply only the next n pending migrations
+	-allow-out-of-order  apply pending migrations older than the latest applied migration
+	-ignore-missing      ignore applied migrations whose files are missing
+	-deployment-id       identifier of the current deployment recorded in the history table
+	-atomic              apply all pending migrations in a single transaction
+	-var                 variable substituted in migration files as key=value (repeatable, env MIGRATHOR_VAR_<KEY>)
+	-tags                select migrations by their tags directive, e.g. prod or !seed (comma-separated)
+	-force               allow mark-applied, unmark and resolve on production-looking databases (host or name containing prod/prd)
 
 Available SSL modes:
 
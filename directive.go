@@ -0,0 +1,171 @@
+package migrathor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// directivePrefix introduces header directives like -- migrathor:no_transaction.
+const directivePrefix = "migrathor:"
+
+// Directives are the settings of a migration given by directives in its
+// header, the comments preceding the first statement:
+//
+//	-- migrathor:no_transaction
+//	-- migrathor:lock_timeout 3s
+//	-- migrathor:statement_timeout 10m
+//	-- migrathor:tags dev,staging
+//
+// Comments may follow the arguments of a directive.
+type Directives struct {
+	// NoTransaction disables the transaction of the migration
+	// (-- migrathor:no_transaction).
+	NoTransaction bool
+
+	// LockTimeout is the lock_timeout during the migration
+	// (-- migrathor:lock_timeout <duration>, zero if unset).
+	LockTimeout time.Duration
+
+	// StatementTimeout is the statement_timeout during the migration
+	// (-- migrathor:statement_timeout <duration>, zero if unset).
+	StatementTimeout time.Duration
+
+	// Tags restrict the migration to runs with matching tags
+	// (-- migrathor:tags <tag>[,<tag>...], see WithTags).
+	Tags []string
+}
+
+// ParseDirectives parses the header directives of the migration named name.
+//
+// ParseDirectives returns a *DirectiveError for unknown, duplicate or
+// malformed directives. Directives following the first statement are
+// ignored.
+func ParseDirectives(name string, buf []byte) (Directives, error) {
+	d := Directives{}
+	seen := map[string]bool{}
+	for _, dir := range header(buf) {
+		fail := func(format string, a ...interface{}) error {
+			return &DirectiveError{Migration: name, Line: dir.line, Message: fmt.Sprintf(format, a...)}
+		}
+		if seen[dir.name] {
+			return Directives{}, fail("duplicate directive %q", dir.name)
+		}
+		seen[dir.name] = true
+
+		args := strings.Fields(dir.args)
+		switch dir.name {
+		case "no_transaction":
+			if len(args) != 0 {
+				return Directives{}, fail("directive %q takes no arguments, got %q", dir.name, dir.args)
+			}
+			d.NoTransaction = true
+		case "lock_timeout", "statement_timeout":
+			if len(args) != 1 {
+				return Directives{}, fail("directive %q takes a duration like 3s, got %q", dir.name, dir.args)
+			}
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil || timeout <= 0 {
+				return Directives{}, fail("directive %q takes a positive duration like 3s, got %q", dir.name, args[0])
+			}
+			if timeout < time.Millisecond {
+				// PostgreSQL takes milliseconds, 0ms would disable the timeout
+				return Directives{}, fail("directive %q takes a duration of at least 1ms, got %q", dir.name, args[0])
+			}
+			if dir.name == "lock_timeout" {
+				d.LockTimeout = timeout
+			} else {
+				d.StatementTimeout = timeout
+			}
+		case "tags":
+			if len(args) == 0 {
+				return Directives{}, fail("directive %q takes a comma-separated list of tags like dev,staging", dir.name)
+			}
+			for _, tag := range strings.Split(strings.Join(args, ""), ",") {
+				if tag == "" || strings.HasPrefix(tag, "!") {
+					return Directives{}, fail("directive %q contains invalid tag %q", dir.name, tag)
+				}
+				d.Tags = append(d.Tags, tag)
+			}
+		default:
+			return Directives{}, fail("unknown directive %q", dir.name)
+		}
+	}
+	return d, nil
+}
+
+// settings returns the settings applied by the timeout directives, passed
+// on in milliseconds.
+func (d Directives) settings() []setting {
+	settings := []setting{}
+	if d.LockTimeout > 0 {
+		settings = append(settings, setting{"lock_timeout", fmt.Sprintf("%dms", d.LockTimeout.Milliseconds())})
+	}
+	if d.StatementTimeout > 0 {
+		settings = append(settings, setting{"statement_timeout", fmt.Sprintf("%dms", d.StatementTimeout.Milliseconds())})
+	}
+	return settings
+}
+
+// directive is a single header directive of a migration.
+type directive struct {
+	name string
+	args string // without trailing comments
+	line int
+}
+
+// header returns the directives within the comments preceding the first
+// statement of a migration. Block comments may be part of the header, but
+// can't contain directives.
+func header(buf []byte) []directive {
+	s := string(buf)
+	directives := []directive{}
+	line := 1
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\n':
+			line++
+			i++
+		case s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\f' || s[i] == '\v':
+			i++
+		case strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			text := strings.TrimSpace(s[i+2 : i+end])
+			if strings.HasPrefix(text, directivePrefix) {
+				// name and arguments are separated by any whitespace, e.g. a tab
+				rest := strings.TrimPrefix(text, directivePrefix)
+				d := directive{name: rest, line: line}
+				if c := strings.IndexFunc(rest, unicode.IsSpace); c >= 0 {
+					d.name, d.args = rest[:c], rest[c:]
+					if c := strings.Index(d.args, "/*"); c >= 0 {
+						d.args = d.args[:c]
+					}
+					if c := strings.Index(d.args, "--"); c >= 0 {
+						d.args = d.args[:c]
+					}
+					d.args = strings.TrimSpace(d.args)
+				}
+				directives = append(directives, d)
+			}
+			i += end
+		case strings.HasPrefix(s[i:], "/*"):
+			end := blockComment(s[i:])
+			line += strings.Count(s[i:i+end], "\n")
+			i += end
+		default:
+			return directives
+		}
+	}
+	return directives
+}
+
+// setting is a run-time parameter of PostgreSQL applied during the execution
+// of a migration.
+type setting struct {
+	name  string
+	value string
+}
@@ -0,0 +1,160 @@
+package migrathor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_header(t *testing.T) {
+	buf := []byte(`
+-- migrathor:no_transaction
+  -- some comment
+--migrathor:lock_timeout	3s /* give up quickly */
+
+/**
+-- migrathor:statement_timeout 1m
+*/
+-- migrathor:statement_timeout 1m -- trailing comment
+CREATE TABLE users ();
+-- migrathor:no_transaction
+`)
+	want := []directive{
+		{name: "no_transaction", line: 2},
+		{name: "lock_timeout", args: "3s", line: 4},
+		{name: "statement_timeout", args: "1m", line: 9},
+	}
+	if got := header(buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("header()\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	tests := []string{
+		"-- migrathor:no_transaction\nVACUUM log;",
+		"  \n  -- migrathor:no_transaction",
+		"  -- migrathor:no_transaction    /* comment */",
+		"-- migrathor:no_transaction",
+		"-- migrathor:lock_timeout 3s\n-- migrathor:no_transaction\nVACUUM log;",
+		"/**\n* Name: vacuum_log\n*/\n-- migrathor:no_transaction\nVACUUM log;",
+	}
+	for _, tt := range tests {
+		d, err := ParseDirectives("test.sql", []byte(tt))
+		if err != nil {
+			t.Errorf("ParseDirectives(%q) failed: %v", tt, err)
+		}
+		if !d.NoTransaction {
+			t.Errorf("ParseDirectives(): transaction suppressor did not fire: %s", tt)
+		}
+	}
+	tests = []string{
+		"CREATE TABLE user();",
+		"CREATE TABLE user();\nDO DATABASE STUFF();",
+		"RANDOM ACCESS MEMORY;\n  -- migrathor:no_transaction /* suppressor not on first line */",
+	}
+	for _, tt := range tests {
+		d, err := ParseDirectives("test.sql", []byte(tt))
+		if err != nil {
+			t.Errorf("ParseDirectives(%q) failed: %v", tt, err)
+		}
+		if d.NoTransaction {
+			t.Errorf("ParseDirectives(): transaction suppressor should not trigger on: %s", tt)
+		}
+	}
+
+	d, err := ParseDirectives("test.sql", []byte("-- migrathor:lock_timeout 3s\n-- migrathor:statement_timeout 10m\nALTER TABLE users ADD COLUMN slug TEXT;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Directives{LockTimeout: time.Second * 3, StatementTimeout: time.Minute * 10}); !reflect.DeepEqual(d, want) {
+		t.Errorf("ParseDirectives()\ngot  %+v\nwant %+v\n", d, want)
+	}
+	want := []setting{{"lock_timeout", "3000ms"}, {"statement_timeout", "600000ms"}}
+	if got := d.settings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	d, err = ParseDirectives("test.sql", []byte("-- migrathor:tags dev, staging\nINSERT INTO users DEFAULT VALUES;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dev", "staging"}; !reflect.DeepEqual(d.Tags, want) {
+		t.Errorf("ParseDirectives() tags\ngot  %v\nwant %v\n", d.Tags, want)
+	}
+}
+
+func TestParseDirectivesInvalid(t *testing.T) {
+	tests := map[string]string{
+		"-- migrathor:no_transation\nVACUUM log;":                  "test.sql:1: unknown directive \"no_transation\"",
+		"\n-- migrathor:no_transaction please":                     "test.sql:2: directive \"no_transaction\" takes no arguments, got \"please\"",
+		"-- migrathor:no_transaction\n-- migrathor:no_transaction": "test.sql:2: duplicate directive \"no_transaction\"",
+		"-- migrathor:lock_timeout":                                "test.sql:1: directive \"lock_timeout\" takes a duration like 3s, got \"\"",
+		"/*\n*/\n-- migrathor:lock_timeout 3":                      "test.sql:3: directive \"lock_timeout\" takes a positive duration like 3s, got \"3\"",
+		"-- migrathor:statement_timeout -1s":                       "test.sql:1: directive \"statement_timeout\" takes a positive duration like 3s, got \"-1s\"",
+		"-- migrathor:lock_timeout\tthree":                         "test.sql:1: directive \"lock_timeout\" takes a positive duration like 3s, got \"three\"",
+		"-- migrathor:lock_timeout 500us":                          "test.sql:1: directive \"lock_timeout\" takes a duration of at least 1ms, got \"500us\"",
+		"-- migrathor:statement_timeout 1s 2s":                     "test.sql:1: directive \"statement_timeout\" takes a duration like 3s, got \"1s 2s\"",
+		"-- migrathor:tags":                                        "test.sql:1: directive \"tags\" takes a comma-separated list of tags like dev,staging",
+		"-- migrathor:tags dev,!seed":                              "test.sql:1: directive \"tags\" contains invalid tag \"!seed\"",
+		"-- migrathor:tags dev,,prod":                              "test.sql:1: directive \"tags\" contains invalid tag \"\"",
+		"-- migrathor:":                                            "test.sql:1: unknown directive \"\"",
+	}
+	for buf, want := range tests {
+		_, err := ParseDirectives("test.sql", []byte(buf))
+		if _, ok := err.(*DirectiveError); !ok {
+			t.Errorf("ParseDirectives(%q) should fail with *DirectiveError, got %v", buf, err)
+			continue
+		}
+		if got := err.Error(); got != want {
+			t.Errorf("ParseDirectives(%q)\ngot  %q\nwant %q\n", buf, got, want)
+		}
+	}
+}
+
+func TestApplyTimeouts(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"2019_03_05_173612_tx.sql":    "-- migrathor:lock_timeout 3s\nCREATE TABLE tx AS SELECT current_setting('lock_timeout') AS timeout;",
+		"2019_03_05_213554_no_tx.sql": "-- migrathor:statement_timeout 10m\n-- migrathor:no_transaction\nCREATE TABLE no_tx AS SELECT current_setting('statement_timeout') AS timeout;",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	steps, err := New(dir).Plan(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[1].Transaction {
+		t.Error("Plan(): no_transaction directive following timeout directive was ignored")
+	}
+	if _, err := New(dir).Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, want := range map[string]string{"tx": "3s", "no_tx": "10min"} {
+		var got string
+		if err := database.QueryRowContext(ctx, `SELECT timeout FROM `+table+`;`).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("timeout of migration %s\ngot  %v\nwant %v\n", table, got, want)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package migrathor_test
 
 import (
+	"context"
+	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"strings"
@@ -29,3 +33,26 @@ func ExampleWithHistoryTable() {
 	table := "schema_history"
 	_ = migrathor.New("database/migrations", migrathor.WithHistoryTable(table))
 }
+
+//go:embed testdata/*.sql
+var migrations embed.FS
+
+func ExampleNewFS() {
+	// compile migrations into the binary and strip the directory prefix
+	source, err := fs.Sub(migrations, "testdata")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_ = migrathor.NewFS(source)
+	// applied, err := migration.Apply(ctx, db)
+}
+
+func ExampleMigration_Register() {
+	migration := migrathor.New("database/migrations")
+	// runs in order with the sql files and inside its own transaction
+	migration.Register("2019_03_06_120000_backfill_slugs", func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE users SET slug = lower(name) WHERE slug IS NULL;`)
+		return err
+	})
+	// applied, err := migration.Apply(ctx, db)
+}
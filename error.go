@@ -1,5 +1,17 @@
 package migrathor
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrDirty is returned when a migration without transaction support failed
+// or is still running. The database is left in an unknown state until an
+// operator resolves the migration (see Resolve).
+var ErrDirty = errors.New("database is dirty")
+
 // DriverError records original sql driver error and supporting info that caused it.
 type DriverError struct {
 	// Info contains supporting info
@@ -11,11 +23,144 @@ type DriverError struct {
 
 func (e *DriverError) Error() string { return e.Info + ": " + e.Err.Error() }
 
-// UnderlyingError returns the underlying error from DriverError.
+// UnderlyingError returns the underlying error from DriverError or MigrationError.
 func UnderlyingError(err error) error {
 	switch err := err.(type) {
 	case *DriverError:
 		return err.Err
+	case *MigrationError:
+		return err.Err
 	}
 	return err
 }
+
+// MigrationError records a failed SQL migration.
+//
+// Migrations without transaction support are executed statement by
+// statement: all statements preceding the failing one took effect.
+//
+// Line, Column and Excerpt locate the error position reported by the server
+// within the migration file after variable substitution. They require a
+// driver error exposing the position like *pq.Error.
+type MigrationError struct {
+	// Migration is the name of the failing migration.
+	Migration string
+
+	// Statement is the index of the failing statement (1-based) or 0 if the
+	// whole migration was executed at once.
+	Statement int
+
+	// StartLine and EndLine are the line range of the failing statement
+	// within the migration file (1-based, zero if Statement is 0).
+	StartLine, EndLine int
+
+	// Line and Column locate the error within the migration file (1-based,
+	// zero if unknown). Columns are counted in characters.
+	Line, Column int
+
+	// Excerpt shows the line of the error with a caret below the column
+	// (empty if unknown).
+	Excerpt string
+
+	// Err is the original (possibly driver-specific) error
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	msg := "failed to execute migration " + e.Migration
+	if e.Statement > 0 {
+		lines := fmt.Sprintf("lines %d-%d", e.StartLine, e.EndLine)
+		if e.StartLine == e.EndLine {
+			lines = fmt.Sprintf("line %d", e.StartLine)
+		}
+		msg = fmt.Sprintf("failed to execute statement %d (%s) of migration %s", e.Statement, lines, e.Migration)
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at %s:%d:%d", e.Migration, e.Line, e.Column)
+	}
+	msg += ": " + e.Err.Error()
+	if e.Excerpt != "" {
+		msg += "\n" + e.Excerpt
+	}
+	return msg
+}
+
+func (e *MigrationError) Unwrap() error { return e.Err }
+
+// ChecksumError records applied migrations whose contents changed after they were applied.
+type ChecksumError struct {
+	// Migrations contains the names of all modified migrations.
+	Migrations []string
+}
+
+func (e *ChecksumError) Error() string {
+	return "contents of applied migrations changed: " + strings.Join(e.Migrations, ", ")
+}
+
+// LockError records a timeout while waiting for the migration lock.
+type LockError struct {
+	// Timeout is the duration waited for the lock.
+	Timeout time.Duration
+
+	// PID is the process id of the backend holding the lock (0 if unknown).
+	PID int
+}
+
+func (e *LockError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("timed out after %s waiting for migration lock", e.Timeout)
+	}
+	return fmt.Sprintf("timed out after %s waiting for migration lock held by PID %d", e.Timeout, e.PID)
+}
+
+// OutOfOrderError records pending migrations which are older than the latest applied migration.
+type OutOfOrderError struct {
+	// Migrations contains the names of all pending migrations out of order.
+	Migrations []string
+
+	// Latest is the name of the latest applied migration.
+	Latest string
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("pending migrations are older than latest applied migration %s: %s", e.Latest, strings.Join(e.Migrations, ", "))
+}
+
+// MissingError records applied migrations which aren't available anymore.
+type MissingError struct {
+	// Migrations contains the names of all missing migrations.
+	Migrations []string
+}
+
+func (e *MissingError) Error() string {
+	return "applied migrations are missing: " + strings.Join(e.Migrations, ", ")
+}
+
+// VariableError records variables used by a migration which aren't defined.
+type VariableError struct {
+	// Migration is the name of the migration using the variables.
+	Migration string
+
+	// Variables contains the names of all undefined variables.
+	Variables []string
+}
+
+func (e *VariableError) Error() string {
+	return fmt.Sprintf("migration %s uses undefined variables: %s", e.Migration, strings.Join(e.Variables, ", "))
+}
+
+// DirectiveError records an unknown or malformed header directive of a migration.
+type DirectiveError struct {
+	// Migration is the name of the migration.
+	Migration string
+
+	// Line is the line of the directive (1-based).
+	Line int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *DirectiveError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Migration, e.Line, e.Message)
+}
@@ -3,6 +3,7 @@ package migrathor
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestDriverError(t *testing.T) {
@@ -25,3 +26,80 @@ func TestDriverError(t *testing.T) {
 		t.Errorf("underlying error returned something wrong\ngot  %q\nwant %q\n", got, want)
 	}
 }
+
+func TestChecksumError(t *testing.T) {
+	err := &ChecksumError{[]string{"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"}}
+
+	got := err.Error()
+	want := "contents of applied migrations changed: 2019_03_05_173612_create_users.sql, 2019_03_05_213554_add_users.sql"
+	if got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	err := &LockError{time.Second * 30, 4242}
+	want := "timed out after 30s waiting for migration lock held by PID 4242"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+	err = &LockError{time.Second * 30, 0}
+	want = "timed out after 30s waiting for migration lock"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
+
+func TestOutOfOrderError(t *testing.T) {
+	err := &OutOfOrderError{[]string{"2019_03_05_173612_create_users.sql"}, "2019_03_05_213554_add_users.sql"}
+	want := "pending migrations are older than latest applied migration 2019_03_05_213554_add_users.sql: 2019_03_05_173612_create_users.sql"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
+
+func TestMissingError(t *testing.T) {
+	err := &MissingError{[]string{"2019_03_05_173612_create_users.sql"}}
+	want := "applied migrations are missing: 2019_03_05_173612_create_users.sql"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
+
+func TestVariableError(t *testing.T) {
+	err := &VariableError{"2019_03_05_173612_create_users.sql", []string{"app_role", "tablespace"}}
+	want := "migration 2019_03_05_173612_create_users.sql uses undefined variables: app_role, tablespace"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
+
+func TestMigrationError(t *testing.T) {
+	uerr := fmt.Errorf("some driver error")
+	err := &MigrationError{Migration: "2019_03_05_213554_add_users.sql", Statement: 4, StartLine: 12, EndLine: 15, Err: uerr}
+	want := "failed to execute statement 4 (lines 12-15) of migration 2019_03_05_213554_add_users.sql: some driver error"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+	err = &MigrationError{Migration: "2019_03_05_213554_add_users.sql", Statement: 1, StartLine: 7, EndLine: 7, Err: uerr}
+	want = "failed to execute statement 1 (line 7) of migration 2019_03_05_213554_add_users.sql: some driver error"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+	err = &MigrationError{Migration: "2019_03_05_213554_add_users.sql", Line: 7, Column: 3, Excerpt: "7 | VACUM users;\n  | ^", Err: uerr}
+	want = "failed to execute migration 2019_03_05_213554_add_users.sql at 2019_03_05_213554_add_users.sql:7:3: some driver error\n7 | VACUM users;\n  | ^"
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+	if got := UnderlyingError(err); got != uerr {
+		t.Errorf("underlying error does not match\ngot  %v\nwant %v\n", got, uerr)
+	}
+}
+
+func TestDirectiveError(t *testing.T) {
+	err := &DirectiveError{"2019_03_05_213554_add_users.sql", 1, `unknown directive "no_transation"`}
+	want := `2019_03_05_213554_add_users.sql:1: unknown directive "no_transation"`
+	if got := err.Error(); got != want {
+		t.Errorf("Error messages did not match\ngot  %q\nwant %q\n", got, want)
+	}
+}
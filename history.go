@@ -0,0 +1,245 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Kind tells how a migration was recorded in the history table.
+type Kind string
+
+const (
+	// KindExecuted marks a migration executed by Apply.
+	KindExecuted Kind = "executed"
+	// KindBaseline marks a migration recorded by Baseline without execution.
+	KindBaseline Kind = "baseline"
+	// KindManual marks a migration recorded by MarkApplied without execution.
+	KindManual Kind = "manual"
+)
+
+// Record is a single entry of the history table.
+//
+// Entries recorded by earlier releases lack some of the fields.
+type Record struct {
+	// Migration is the filename of the applied migration.
+	Migration string
+
+	// AppliedAt is the time of execution.
+	AppliedAt time.Time
+
+	// ExecutionTime is the duration of execution.
+	ExecutionTime time.Duration
+
+	// Checksum is the SHA-256 sum of the migration contents (hex encoded).
+	Checksum string
+
+	// AppliedBy is the database user which applied the migration.
+	AppliedBy string
+
+	// ApplicationName is the application_name of the database session.
+	ApplicationName string
+
+	// Hostname is the name of the host which applied the migration.
+	Hostname string
+
+	// Version is the version of the application which applied the migration
+	// (see WithVersion).
+	Version string
+
+	// DeploymentID identifies the deployment which applied the migration
+	// (see WithDeploymentID).
+	DeploymentID string
+
+	// Kind tells whether the migration was executed or only recorded.
+	Kind Kind
+
+	// Tags are the active tags of the run (see WithTags).
+	Tags []string
+
+	// Path is the path of the migration file relative to the migration
+	// directory (empty for Go migrations).
+	Path string
+
+	// Dirty marks a migration without transaction support which failed or
+	// is still running (see Resolve).
+	Dirty bool
+}
+
+// History returns all entries of the history table in order of execution.
+//
+// History is read-only and returns no entries if the history table doesn't
+// exist yet.
+func (m *Migration) History(ctx context.Context, db *sql.DB) ([]Record, error) {
+	return m.historyIfExists(ctx, db)
+}
+
+// record logs an executed migration into the history table.
+//
+// The database user and application_name of the session as well as the
+// hostname of the client are recorded for auditing. The previous entry of a
+// repeatable migration and the dirty entry of a migration without transaction
+// support are replaced, so db must be a transaction for the replacement to be
+// atomic.
+func (m *Migration) record(ctx context.Context, db queryer, step Step, kind Kind, executionTime time.Duration) error {
+	del := fmt.Sprintf(`DELETE FROM %s WHERE migration = $1 AND (dirty OR $2);`, m.historyTable())
+	if _, err := db.ExecContext(ctx, del, step.Migration, repeatable(step.Migration)); err != nil {
+		return &DriverError{fmt.Sprintf("failed to execute SQL statement %q", del), err}
+	}
+
+	cmd := fmt.Sprintf(`
+INSERT INTO %s (migration, execution_time, checksum, applied_by, application_name, hostname, version, deployment_id, kind, tags, path)
+VALUES ($1, $2, NULLIF($3, ''), current_user, current_setting('application_name'), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''));`[1:], m.historyTable())
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		m.logger("failed to get hostname: " + err.Error())
+	}
+	if _, err := db.ExecContext(ctx, cmd, step.Migration, executionTime, step.checksum, hostname, m.version, m.deploymentID, string(kind), strings.Join(m.tags, ","), step.file); err != nil {
+		return &DriverError{
+			fmt.Sprintf("failed to execute SQL statement %q", strings.Join(strings.Fields(cmd), " ")),
+			err,
+		}
+	}
+	return nil
+}
+
+// recordDirty records a migration without transaction support as dirty
+// before it is executed.
+//
+// A failure leaves the database in an unknown state: the dirty entry blocks
+// further runs until an operator resolves it. The entry is replaced by
+// record after a successful execution.
+func (m *Migration) recordDirty(ctx context.Context, db executor, step Step) error {
+	return transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
+		if err := m.record(ctx, tx, step, KindExecuted, 0); err != nil {
+			return err
+		}
+		cmd := fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1;`, m.historyTable())
+		if _, err := tx.ExecContext(ctx, cmd, step.Migration); err != nil {
+			return &DriverError{fmt.Sprintf("failed to execute SQL statement %q", cmd), err}
+		}
+		return nil
+	})
+}
+
+// dirtyMigrations returns the names of all dirty records.
+func dirtyMigrations(records []Record) []string {
+	dirty := []string{}
+	for _, r := range records {
+		if r.Dirty {
+			dirty = append(dirty, r.Migration)
+		}
+	}
+	return dirty
+}
+
+// names returns the migration names of all records.
+func names(records []Record) []string {
+	names := []string{}
+	for _, r := range records {
+		names = append(names, r.Migration)
+	}
+	return names
+}
+
+// historyIfExists returns all entries from the history table or none if the
+// history table doesn't exist yet.
+func (m *Migration) historyIfExists(ctx context.Context, db executor) ([]Record, error) {
+	exist, err := m.initialized(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return []Record{}, nil
+	}
+	return m.history(ctx, db)
+}
+
+// history returns all entries from the history table in order of execution.
+//
+// History tables created by older versions lack newer columns, which is why
+// columns are matched by name and absent columns are left empty.
+func (m *Migration) history(ctx context.Context, db executor) ([]Record, error) {
+	cmd := fmt.Sprintf(`SELECT * FROM %s ORDER BY id ASC;`, m.historyTable())
+	rows, err := db.QueryContext(ctx, cmd)
+	if err != nil {
+		return nil, &DriverError{"failed to query applied migrations", err}
+	}
+	defer logCloser(rows, m.logger)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, &DriverError{"failed to query applied migrations", err}
+	}
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		var executionTime float64 // stored in nanoseconds
+		var dirty sql.NullBool
+		var checksum, appliedBy, applicationName, hostname, version, deployment, kind, tags, path sql.NullString
+		dest := make([]interface{}, len(columns))
+		for i, column := range columns {
+			switch column {
+			case "migration":
+				dest[i] = &r.Migration
+			case "applied_at":
+				dest[i] = &r.AppliedAt
+			case "execution_time":
+				dest[i] = &executionTime
+			case "checksum":
+				dest[i] = &checksum
+			case "applied_by":
+				dest[i] = &appliedBy
+			case "application_name":
+				dest[i] = &applicationName
+			case "hostname":
+				dest[i] = &hostname
+			case "version":
+				dest[i] = &version
+			case "deployment_id":
+				dest[i] = &deployment
+			case "kind":
+				dest[i] = &kind
+			case "dirty":
+				dest[i] = &dirty
+			case "tags":
+				dest[i] = &tags
+			case "path":
+				dest[i] = &path
+			default:
+				dest[i] = new(interface{})
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, &DriverError{"failed to row scan entry in query for applied migrations", err}
+		}
+		r.ExecutionTime = time.Duration(executionTime)
+		r.Checksum = checksum.String
+		r.AppliedBy = appliedBy.String
+		r.ApplicationName = applicationName.String
+		r.Hostname = hostname.String
+		r.Version = version.String
+		r.DeploymentID = deployment.String
+		r.Path = path.String
+		r.Dirty = dirty.Bool
+		if tags.String != "" {
+			r.Tags = strings.Split(tags.String, ",")
+		}
+		r.Kind = Kind(kind.String)
+		if r.Kind == "" {
+			r.Kind = KindExecuted // recorded before kinds were introduced
+		}
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &DriverError{"failed to query applied migrations", err}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,55 @@
+package migrathor
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestMigration_History(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata", WithVersion("v1.2.3"), WithDeploymentID("deploy-42"))
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("History() without history table should be empty, got %v", records)
+	}
+
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	records, err = migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("History() returned %d records, want 2", len(records))
+	}
+
+	hostname, _ := os.Hostname()
+	for _, r := range records {
+		if r.AppliedBy != "postgres" {
+			t.Errorf("Record.AppliedBy = %q, want %q", r.AppliedBy, "postgres")
+		}
+		if r.Hostname != hostname {
+			t.Errorf("Record.Hostname = %q, want %q", r.Hostname, hostname)
+		}
+		if r.Version != "v1.2.3" {
+			t.Errorf("Record.Version = %q, want %q", r.Version, "v1.2.3")
+		}
+		if r.DeploymentID != "deploy-42" {
+			t.Errorf("Record.DeploymentID = %q, want %q", r.DeploymentID, "deploy-42")
+		}
+		if r.Checksum == "" {
+			t.Errorf("Record.Checksum of %s is empty", r.Migration)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// callbackPrefix marks files of the migration directory which are no
+	// migrations, e.g. _before_migrate.sql.
+	callbackPrefix = "_"
+	// beforeMigrate is executed before the first pending migration.
+	beforeMigrate = "_before_migrate.sql"
+	// afterMigrate is executed after the last pending migration.
+	afterMigrate = "_after_migrate.sql"
+)
+
+// Hook is called around migrations with the name of the migration, its
+// execution time and its error.
+//
+// Hooks around the whole run (see WithBeforeAll and WithAfterAll) receive an
+// empty migration name and the execution time of the whole run.
+type Hook func(ctx context.Context, migration string, duration time.Duration, err error)
+
+// callback returns whether the file is a callback file.
+func callback(file string) bool {
+	return strings.HasPrefix(filepath.Base(file), callbackPrefix)
+}
+
+// around executes a single migration between the hooks of WithBeforeEach and
+// WithAfterEach.
+func (m *Migration) around(ctx context.Context, migration string, fn func() error) error {
+	if m.beforeEach != nil {
+		m.beforeEach(ctx, migration, 0, nil)
+	}
+	start := time.Now()
+	err := fn()
+	if m.afterEach != nil {
+		m.afterEach(ctx, migration, time.Since(start), err)
+	}
+	return err
+}
+
+// callbacks reads the callback files of the migration directory and
+// substitutes their variables, so errors surface before anything is executed.
+// Missing callback files are left out.
+func (m *Migration) callbacks() (map[string]string, error) {
+	callbacks := map[string]string{}
+	for _, name := range []string{beforeMigrate, afterMigrate} {
+		buf, err := fs.ReadFile(m.fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file contents of %q: %v", filepath.Join(m.path, name), err)
+		}
+		script, err := m.substitute(name, string(buf))
+		if err != nil {
+			return nil, err
+		}
+		callbacks[name] = script
+	}
+	return callbacks, nil
+}
+
+// runCallbackTx executes the callback file in its own transaction, if it
+// exists.
+func (m *Migration) runCallbackTx(ctx context.Context, db executor, name string, callbacks map[string]string) error {
+	script, ok := callbacks[name]
+	if !ok {
+		return nil
+	}
+	return transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
+		return m.runCallback(ctx, tx, name, script)
+	})
+}
+
+// runCallback executes the script of a callback file on tx. Empty scripts of
+// missing callback files are skipped.
+//
+// Callbacks are neither checksummed nor recorded in the history table.
+func (m *Migration) runCallback(ctx context.Context, tx *sql.Tx, name, script string) error {
+	if script == "" {
+		return nil
+	}
+
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		merr := &MigrationError{Migration: name, Err: err}
+		merr.locate(script, script, 0)
+		return merr
+	}
+	m.logger(fmt.Sprintf("%s: callback executed in %s", name, time.Since(start)))
+	return nil
+}
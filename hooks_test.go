@@ -0,0 +1,190 @@
+package migrathor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMigration_availableCallbacks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users ();")},
+		"_before_migrate.sql":                {Data: []byte("SELECT 1;")},
+		"_after_migrate.sql":                 {Data: []byte("ANALYZE;")},
+	}
+	migration := NewFS(fsys)
+
+	got, err := migration.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("available()\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestMigration_callbacks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users ();")},
+		"_after_migrate.sql":                 {Data: []byte("GRANT SELECT ON ALL TABLES IN SCHEMA public TO ${role};")},
+	}
+	migration := NewFS(fsys, WithVariables(map[string]string{"role": "app"}))
+
+	got, err := migration.callbacks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{afterMigrate: "GRANT SELECT ON ALL TABLES IN SCHEMA public TO app;"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("callbacks()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// undefined variables fail before any migration is executed
+	if _, err := NewFS(fsys).callbacks(); err == nil {
+		t.Error("callbacks() should fail for undefined variables")
+	}
+}
+
+func TestMigration_around(t *testing.T) {
+	events := []string{}
+	hook := func(name string) Hook {
+		return func(ctx context.Context, migration string, duration time.Duration, err error) {
+			events = append(events, fmt.Sprintf("%s %s %v", name, migration, err))
+		}
+	}
+	migration := New("", WithBeforeEach(hook("before")), WithAfterEach(hook("after")))
+
+	failure := errors.New("random access memory")
+	err := migration.around(context.Background(), "1_a.sql", func() error {
+		events = append(events, "execute")
+		return failure
+	})
+	if err != failure {
+		t.Errorf("around() should return the error of the migration, got %v", err)
+	}
+	want := []string{"before 1_a.sql <nil>", "execute", "after 1_a.sql random access memory"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("around()\ngot  %v\nwant %v\n", events, want)
+	}
+
+	// no hooks at all
+	if err := New("").around(context.Background(), "1_a.sql", func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyHooks(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users (name TEXT);")},
+		"2019_03_05_213554_add_users.sql":    {Data: []byte("INSERT INTO users VALUES ('Mike');")},
+		"_before_migrate.sql":                {Data: []byte("CREATE TABLE IF NOT EXISTS callbacks (name TEXT);\nINSERT INTO callbacks VALUES ('before ${env}');")},
+		"_after_migrate.sql":                 {Data: []byte("INSERT INTO callbacks VALUES ('after ${env}');")},
+	}
+	events := []string{}
+	hook := func(name string) Hook {
+		return func(ctx context.Context, migration string, duration time.Duration, err error) {
+			events = append(events, fmt.Sprintf("%s %s %v", name, migration, err))
+		}
+	}
+	migration := NewFS(fsys,
+		WithVariables(map[string]string{"env": "test"}),
+		WithBeforeAll(hook("before all")),
+		WithAfterAll(hook("after all")),
+		WithBeforeEach(hook("before")),
+		WithAfterEach(hook("after")),
+	)
+	defer database.ExecContext(ctx, "DROP TABLE IF EXISTS callbacks;")
+
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"before all  <nil>",
+		"before 2019_03_05_173612_create_users.sql <nil>",
+		"after 2019_03_05_173612_create_users.sql <nil>",
+		"before 2019_03_05_213554_add_users.sql <nil>",
+		"after 2019_03_05_213554_add_users.sql <nil>",
+		"after all  <nil>",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("hooks\ngot  %v\nwant %v\n", events, want)
+	}
+
+	rows, err := database.QueryContext(ctx, "SELECT name FROM callbacks;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	callbacks := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		callbacks = append(callbacks, name)
+	}
+	if want := []string{"before test", "after test"}; !reflect.DeepEqual(callbacks, want) {
+		t.Errorf("callbacks\ngot  %v\nwant %v\n", callbacks, want)
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("callbacks must not be recorded, got %v", records)
+	}
+
+	// nothing pending, no hooks
+	events = []string{}
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("hooks should not be called without pending migrations, got %v", events)
+	}
+}
+
+func TestApplyCallbacksSingleTransaction(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users (name TEXT);")},
+		"_after_migrate.sql":                 {Data: []byte("GRANT SELECT ON users TO role_does_not_exist;")},
+	}
+	migration := NewFS(fsys, WithSingleTransaction())
+	if _, err := migration.Apply(ctx, database); err == nil {
+		t.Fatal("Apply() should fail with failing callback")
+	}
+
+	// the failing callback rolled back the migration
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("History() should be empty after failed single transaction, got %v", records)
+	}
+	var exist bool
+	if err := database.QueryRowContext(ctx, `SELECT to_regclass('users') IS NOT NULL;`).Scan(&exist); err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Error("table users should have been rolled back")
+	}
+}
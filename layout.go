@@ -0,0 +1,116 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// layouts contains the statements upgrading the history table to the layout
+// version of the respective index. Version 1 is the initial layout created by
+// initialize. Statements are formatted with the history table and the audit
+// table.
+//
+// Statements must be idempotent: history tables created by earlier releases
+// carry no layout version and are treated as version 1.
+var layouts = []string{
+	0: ``,
+	1: ``,
+	2: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS checksum TEXT;`,
+	3: `
+ALTER TABLE %[1]s
+	ADD COLUMN IF NOT EXISTS applied_by TEXT,
+	ADD COLUMN IF NOT EXISTS application_name TEXT,
+	ADD COLUMN IF NOT EXISTS hostname TEXT,
+	ADD COLUMN IF NOT EXISTS version TEXT,
+	ADD COLUMN IF NOT EXISTS deployment_id TEXT;`[1:],
+	4: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS kind TEXT;`,
+	5: `
+CREATE TABLE IF NOT EXISTS %[2]s (
+	id integer PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	migration TEXT NOT NULL,
+	action TEXT NOT NULL,
+	checksum TEXT,
+	performed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	performed_by TEXT NOT NULL,
+	application_name TEXT,
+	hostname TEXT,
+	version TEXT,
+	deployment_id TEXT
+);`[1:],
+	6: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT false;`,
+	7: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS tags TEXT;`,
+	8: `ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS path TEXT;`,
+}
+
+// currentLayout is the layout version of history tables created by this release.
+var currentLayout = len(layouts) - 1
+
+// layoutComment is the table comment recording the layout version.
+const layoutComment = "migrathor layout %d"
+
+// upgrade brings an existing history table up to the current layout.
+//
+// All upgrade steps are executed in a single transaction. Apply holds the
+// migration lock while upgrading, so concurrent upgrades are not an issue.
+func (m *Migration) upgrade(ctx context.Context, db executor) error {
+	return transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
+		version, err := m.layout(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if version == currentLayout {
+			return nil
+		}
+		if version > currentLayout {
+			return fmt.Errorf("history table %s has layout %d, which is newer than the supported layout %d: please upgrade migrathor", m.historyTable(), version, currentLayout)
+		}
+		if err := m.upgradeLayout(ctx, tx, version); err != nil {
+			return err
+		}
+		m.logger(fmt.Sprintf("History table upgraded from layout %d to %d.", version, currentLayout))
+		return nil
+	})
+}
+
+// upgradeLayout executes all upgrade steps following the layout version and
+// records the current layout version.
+func (m *Migration) upgradeLayout(ctx context.Context, tx *sql.Tx, version int) error {
+	for v := version + 1; v <= currentLayout; v++ {
+		if layouts[v] == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(layouts[v], m.historyTable(), m.auditTable())); err != nil {
+			return &DriverError{fmt.Sprintf("failed to upgrade history table to layout %d", v), err}
+		}
+	}
+
+	// COMMENT doesn't support parameters, but the comment is no user input
+	cmd := fmt.Sprintf("COMMENT ON TABLE %s IS '"+layoutComment+"';", m.historyTable(), currentLayout)
+	if _, err := tx.ExecContext(ctx, cmd); err != nil {
+		return &DriverError{"failed to record layout of history table", err}
+	}
+	return nil
+}
+
+// layout returns the layout version of the existing history table.
+func (m *Migration) layout(ctx context.Context, db queryer) (int, error) {
+	var comment string
+	cmd := `SELECT COALESCE(obj_description(to_regclass($1), 'pg_class'), '');`
+	if err := db.QueryRowContext(ctx, cmd, m.historyTable()).Scan(&comment); err != nil {
+		return 0, &DriverError{"failed to query layout of history table", err}
+	}
+	return parseLayout(comment), nil
+}
+
+// parseLayout returns the layout version recorded in the table comment.
+//
+// Tables without a layout comment were created by releases preceding layout
+// versioning and are treated as version 1.
+func parseLayout(comment string) int {
+	var version int
+	if _, err := fmt.Sscanf(comment, layoutComment, &version); err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
@@ -0,0 +1,63 @@
+package migrathor
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_parseLayout(t *testing.T) {
+	tests := map[string]int{
+		"":                    1,
+		"some user comment":   1,
+		"migrathor layout 0":  1,
+		"migrathor layout 2":  2,
+		"migrathor layout 42": 42,
+	}
+	for comment, want := range tests {
+		if got := parseLayout(comment); got != want {
+			t.Errorf("parseLayout(%q) = %d, want %d", comment, got, want)
+		}
+	}
+}
+
+func TestMigration_upgradeLayout(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+	if err := migration.initialize(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	version, err := migration.layout(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != currentLayout {
+		t.Fatalf("new history table has layout %d, want %d", version, currentLayout)
+	}
+
+	// downgrade the recorded version: upgrade steps must be idempotent
+	if _, err := database.ExecContext(ctx, `COMMENT ON TABLE migrations IS NULL;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.upgrade(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if version, err = migration.layout(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if version != currentLayout {
+		t.Fatalf("upgraded history table has layout %d, want %d", version, currentLayout)
+	}
+
+	// refuse to touch history tables of newer releases
+	if _, err := database.ExecContext(ctx, `COMMENT ON TABLE migrations IS 'migrathor layout 1000';`); err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.upgrade(ctx, database); err == nil {
+		t.Error("upgrade() should refuse newer layouts")
+	}
+}
@@ -0,0 +1,93 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"time"
+)
+
+// lockPollInterval is the delay between two attempts to acquire the migration lock.
+const lockPollInterval = time.Millisecond * 250
+
+// lockKey derives the advisory lock key from the name of the history table.
+//
+// Migrations sharing a history table share a lock, too.
+func (m *Migration) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("migrathor:" + m.historyTable()))
+	return int64(h.Sum64())
+}
+
+// lock acquires a session-level advisory lock on conn.
+//
+// lock waits up to the configured lock timeout for other sessions to release
+// the lock and returns a *LockError afterwards.
+func (m *Migration) lock(ctx context.Context, conn *sql.Conn) error {
+	key := m.lockKey()
+	deadline := time.Now().Add(m.lockTimeout)
+	waiting := false
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1);`, key).Scan(&locked); err != nil {
+			return &DriverError{"failed to acquire migration lock", err}
+		}
+		if locked {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			pid, err := m.lockHolder(ctx, conn, key)
+			if err != nil {
+				return err
+			}
+			return &LockError{m.lockTimeout, pid}
+		}
+		if !waiting {
+			waiting = true
+			m.logger("Waiting for migration lock held by another session.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// unlock releases the advisory lock acquired by lock.
+//
+// The lock is released even if the migration context was canceled: a pooled
+// connection must not keep holding it.
+func (m *Migration) unlock(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, m.lockKey()); err != nil {
+		m.logger("failed to release migration lock: " + err.Error())
+	}
+}
+
+// lockHolder returns the PID of the backend holding the advisory lock or 0 if
+// the lock is not held anymore.
+//
+// PostgreSQL splits bigint advisory lock keys into classid (high 32 bits) and
+// objid (low 32 bits) with objsubid 1.
+func (m *Migration) lockHolder(ctx context.Context, conn *sql.Conn, key int64) (int, error) {
+	cmd := `
+SELECT pid
+FROM pg_locks
+WHERE locktype = 'advisory'
+AND classid::bigint = $1
+AND objid::bigint = $2
+AND objsubid = 1
+AND granted
+LIMIT 1;`[1:]
+	classid, objid := int64(uint64(key)>>32), int64(uint32(key))
+
+	var pid int
+	if err := conn.QueryRowContext(ctx, cmd, classid, objid).Scan(&pid); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, &DriverError{"failed to query holder of migration lock", err}
+	}
+	return pid, nil
+}
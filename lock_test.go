@@ -0,0 +1,56 @@
+package migrathor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMigration_lockKey(t *testing.T) {
+	a := New("testdata").lockKey()
+	if b := New("other").lockKey(); a != b {
+		t.Errorf("lockKey() should only depend on the history table: %d != %d", a, b)
+	}
+	if b := New("testdata", WithHistoryTable("history")).lockKey(); a == b {
+		t.Errorf("lockKey() should differ between history tables: %d == %d", a, b)
+	}
+}
+
+func TestMigration_lock(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata", WithLockTimeout(time.Millisecond*500))
+
+	// hold the lock in another session
+	holder, err := database.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if err := migration.lock(ctx, holder); err != nil {
+		t.Fatal(err)
+	}
+	var pid int
+	if err := holder.QueryRowContext(ctx, `SELECT pg_backend_pid();`).Scan(&pid); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migration.Apply(ctx, database)
+	lerr, ok := err.(*LockError)
+	if !ok {
+		t.Fatalf("Apply() should return *LockError, got %v", err)
+	}
+	if lerr.PID != pid {
+		t.Errorf("LockError.PID = %d, want %d", lerr.PID, pid)
+	}
+
+	// release the lock and try again
+	migration.unlock(holder)
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+}
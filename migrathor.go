@@ -1,11 +1,11 @@
 package migrathor
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
@@ -18,6 +18,7 @@ import (
 const (
 	defaultHistoryTable    = "migrations"
 	defaultTimestampFormat = "2006_01_02_150405"
+	defaultLockTimeout     = time.Minute
 )
 
 // Logger is a generic logging func.
@@ -26,20 +27,54 @@ type Logger func(...interface{})
 // FilenameFormatter takes a migration name and formats it into a filename.
 type FilenameFormatter func(string) string
 
-// A Migration implements database migrations with sql files using the native
-// file system restricted to a specific directory tree.
+// A Migration implements database migrations with sql files using either the
+// native file system restricted to a specific directory tree or any fs.FS.
 //
 // An empty Migration path is treated as ".".
 type Migration struct {
-	path      string
-	table     string
-	formatter FilenameFormatter
-	logger    Logger
+	path            string // empty if migrations are read from fs.FS
+	fsys            fs.FS
+	schema          string // target schema of migrations (empty for current schema)
+	historySchema   string // schema of history table (empty for current schema)
+	table           string
+	lockTimeout     time.Duration
+	allowOutOfOrder bool
+	ignoreMissing   bool
+	singleTx        bool
+	recursive       bool
+	paths           map[string]string // resolved migration files of a run, see snapshot
+	beforeEach      Hook
+	afterEach       Hook
+	beforeAll       Hook
+	afterAll        Hook
+	registered      []goMigration
+	variables       map[string]string
+	tags            []string
+	version         string
+	deploymentID    string
+	formatter       FilenameFormatter
+	logger          Logger
 }
 
-// New returns a new Migration.
+// New returns a new Migration reading migrations from the directory path.
 func New(path string, options ...Option) *Migration {
-	mig := &Migration{path: path}
+	if path == "" {
+		path = "."
+	}
+	return newMigration(path, os.DirFS(path), options)
+}
+
+// NewFS returns a new Migration reading migrations from the root of fsys,
+// e.g. an embed.FS with the migrations compiled into the binary.
+//
+// Use fs.Sub to select a subdirectory of fsys. Create is not supported as
+// fsys is treated as read-only.
+func NewFS(fsys fs.FS, options ...Option) *Migration {
+	return newMigration("", fsys, options)
+}
+
+func newMigration(path string, fsys fs.FS, options []Option) *Migration {
+	mig := &Migration{path: path, fsys: fsys}
 
 	for _, option := range options {
 		option(mig)
@@ -51,6 +86,14 @@ func New(path string, options ...Option) *Migration {
 	if mig.table == "" {
 		mig.table = defaultHistoryTable
 	}
+	if i := strings.Index(mig.table, "."); i >= 0 {
+		mig.historySchema, mig.table = mig.table[:i], mig.table[i+1:]
+	} else {
+		mig.historySchema = mig.schema
+	}
+	if mig.lockTimeout <= 0 {
+		mig.lockTimeout = defaultLockTimeout
+	}
 	if mig.logger == nil {
 		mig.logger = log.New(ioutil.Discard, "", 0).Print
 	}
@@ -66,6 +109,9 @@ func New(path string, options ...Option) *Migration {
 //
 // The migration directory will be automatically created if it doesn't exist.
 func (m *Migration) Create(name string) (filename string, err error) {
+	if m.path == "" {
+		return "", fmt.Errorf("failed to create migration %q: migrations read from fs.FS are read-only", name)
+	}
 	file := m.formatter(name)
 
 	if err := os.MkdirAll(m.path, 0755); err != nil {
@@ -82,118 +128,527 @@ func (m *Migration) Create(name string) (filename string, err error) {
 	return file, nil
 }
 
+// Apply executes all pending migrations in order and returns the applied ones.
+//
+// The history table is created if it doesn't exist yet. Apply holds an
+// advisory lock for the whole run, so concurrent calls against the same
+// history table are executed one after another.
+//
+// Migrations without transaction support are recorded as dirty before they
+// are executed. If one of them fails, later runs fail with ErrDirty until
+// the migration is resolved (see Resolve).
 func (m *Migration) Apply(ctx context.Context, db *sql.DB) (applied []string, err error) {
-	exist, err := m.initialized(ctx, db)
+	return m.applyTarget(ctx, db, target{})
+}
+
+// ApplyTo executes all pending migrations up to and including the target
+// migration and returns the applied ones.
+//
+// The target is either a migration filename, with or without extension, or
+// an unambiguous prefix of one, e.g. its timestamp. ApplyTo fails if the
+// target doesn't exist or was already applied.
+func (m *Migration) ApplyTo(ctx context.Context, db *sql.DB, target string) (applied []string, err error) {
+	if target == "" {
+		return []string{}, fmt.Errorf("failed to apply migrations: empty target migration")
+	}
+	return m.applyTarget(ctx, db, targetMigration(target))
+}
+
+// ApplySteps executes the next n pending migrations and returns the applied ones.
+func (m *Migration) ApplySteps(ctx context.Context, db *sql.DB, n int) (applied []string, err error) {
+	if n <= 0 {
+		return []string{}, fmt.Errorf("failed to apply migrations: steps must be positive, got %d", n)
+	}
+	return m.applyTarget(ctx, db, targetSteps(n))
+}
+
+func (m *Migration) applyTarget(ctx context.Context, db *sql.DB, t target) (applied []string, err error) {
+	applied = []string{}
+	err = m.exclusive(ctx, db, func(conn *sql.Conn) error {
+		applied, err = m.run(ctx, conn, t)
+		return err
+	})
+	return applied, err
+}
+
+// exclusive calls fn with a single connection holding the migration lock.
+//
+// The search_path of the connection is set to the target schema, if any.
+func (m *Migration) exclusive(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	// the session-level advisory lock requires a single connection for the whole run
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		return []string{}, err
+		return &DriverError{"failed to get database connection", err}
+	}
+	defer logCloser(conn, m.logger)
+
+	if err := m.lock(ctx, conn); err != nil {
+		return err
+	}
+	defer m.unlock(conn)
+
+	if m.schema != "" {
+		if err := m.useSchema(ctx, conn); err != nil {
+			return err
+		}
+		defer m.resetSchema(conn)
+	}
+
+	return fn(conn)
+}
+
+// prepare creates the history table or upgrades an existing one to the
+// current layout.
+func (m *Migration) prepare(ctx context.Context, conn executor) error {
+	exist, err := m.initialized(ctx, conn)
+	if err != nil {
+		return err
 	}
 	if !exist {
-		if err := m.initialize(ctx, db); err != nil {
-			return []string{}, err
+		if err := m.initialize(ctx, conn); err != nil {
+			return err
 		}
 		m.logger("History table created successfully.")
+		return nil
 	}
+	return m.upgrade(ctx, conn)
+}
 
-	available, err := m.available()
+// run executes the pending migrations selected by t on a locked connection.
+func (m *Migration) run(ctx context.Context, conn executor, t target) (applied []string, err error) {
+	if err := m.prepare(ctx, conn); err != nil {
+		return []string{}, err
+	}
+
+	run, available, err := m.snapshot()
 	if err != nil {
 		return []string{}, err
 	}
 
-	applied, err = m.applied(ctx, db)
+	records, err := m.history(ctx, conn)
 	if err != nil {
 		return []string{}, err
 	}
 
-	// Are there available migrations which were not applied yet?
-	pending := filterExcept(available, applied)
+	pending, err := run.pending(available, records)
+	if err != nil {
+		return []string{}, err
+	}
+	pending, err = t.limit(pending, available, records)
+	if err != nil {
+		return []string{}, err
+	}
 	if len(pending) == 0 {
 		return []string{}, nil // nothing to do here
 	}
+
+	steps, err := run.plan(pending)
+	if err != nil {
+		return []string{}, err
+	}
+	callbacks, err := m.callbacks()
+	if err != nil {
+		return []string{}, err
+	}
+
+	return m.apply(ctx, conn, steps, callbacks)
+}
+
+// pending returns all available migrations which were not applied yet
+// in order of execution followed by all outdated repeatable migrations.
+// Migrations skipped by the active tags are left out.
+func (m *Migration) pending(available []string, records []Record) ([]string, error) {
+	// Did a migration without transaction support fail halfway?
+	if dirty := dirtyMigrations(records); len(dirty) > 0 {
+		return nil, fmt.Errorf("%w: migrations failed without transaction and must be resolved: %s", ErrDirty, strings.Join(dirty, ", "))
+	}
+
+	// Were applied migrations deleted or edited after the fact?
+	if err := m.verify(available, records); err != nil {
+		return nil, err
+	}
+
+	// Are there available migrations which were not applied yet?
+	pending := filterExcept(versioned(available), names(records))
 	sort.Strings(pending)
 
-	return m.apply(ctx, db, pending)
+	// Are some of them restricted to other tags?
+	skipped, err := m.skipped(pending)
+	if err != nil {
+		return nil, err
+	}
+	pending = filterExcept(pending, skipped)
+
+	// Were older migrations added after newer ones were applied?
+	if late := outOfOrder(pending, records); len(late) > 0 && !m.allowOutOfOrder {
+		return nil, &OutOfOrderError{late, latest(records)}
+	}
+
+	// Did repeatable migrations change since their last execution?
+	outdated, err := m.outdated(available, records)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(outdated)
+	if skipped, err = m.skipped(outdated); err != nil {
+		return nil, err
+	}
+	outdated = filterExcept(outdated, skipped)
+
+	return append(pending, outdated...), nil
+}
+
+// outOfOrder returns all pending migrations which sort before the latest
+// applied migration.
+func outOfOrder(pending []string, records []Record) []string {
+	last := latest(records)
+	return filter(pending, func(s string) bool {
+		return s < last
+	})
 }
 
-func (m *Migration) apply(ctx context.Context, db *sql.DB, pending []string) (applied []string, err error) {
+// latest returns the applied versioned migration sorting last.
+//
+// Migrations recorded by MarkApplied are ignored: a hotfix applied by hand
+// must not turn the migrations pending before it into out of order ones.
+func latest(records []Record) string {
+	last := ""
+	for _, r := range records {
+		if !repeatable(r.Migration) && r.Kind != KindManual && r.Migration > last {
+			last = r.Migration
+		}
+	}
+	return last
+}
+
+// apply executes the steps between the hooks and callbacks around the run.
+//
+// Migrations without transaction support are refused in single transaction
+// mode before any hook or callback runs.
+func (m *Migration) apply(ctx context.Context, conn executor, steps []Step, callbacks map[string]string) (applied []string, err error) {
+	if m.singleTx {
+		if err := atomic(steps); err != nil {
+			return []string{}, err
+		}
+	}
+
+	start := time.Now()
+	if m.beforeAll != nil {
+		m.beforeAll(ctx, "", 0, nil)
+	}
+	if m.afterAll != nil {
+		defer func() {
+			m.afterAll(ctx, "", time.Since(start), err)
+		}()
+	}
+
+	if m.singleTx {
+		return m.applyAtomic(ctx, conn, steps, callbacks)
+	}
+
+	if err := m.runCallbackTx(ctx, conn, beforeMigrate, callbacks); err != nil {
+		return []string{}, err
+	}
+	if applied, err = m.applySteps(ctx, conn, steps); err != nil {
+		return applied, err
+	}
+	if err := m.runCallbackTx(ctx, conn, afterMigrate, callbacks); err != nil {
+		return applied, err
+	}
+	return applied, nil
+}
+
+// applySteps executes each pending migration in its own transaction, if
+// supported.
+func (m *Migration) applySteps(ctx context.Context, conn executor, steps []Step) (applied []string, err error) {
 	applied = []string{}
-	insertCmd := fmt.Sprintf("INSERT INTO %s (migration, execution_time) VALUES ($1, $2);", m.table)
-	// read pending migration files and execute them
-	for _, migration := range pending {
-		path := filepath.Join(m.path, migration)
-		buf, err := ioutil.ReadFile(path)
+	// execute pending migrations
+	for _, step := range steps {
+		err = m.around(ctx, step.Migration, func() error {
+			if step.Transaction {
+				return transaction(ctx, conn, m.logger, func(tx *sql.Tx) error {
+					// execute migration in transaction
+					return m.execute(ctx, tx, step)
+				})
+			}
+			// execute migration with no transaction support, a failure leaves it dirty
+			if err := m.recordDirty(ctx, conn, step); err != nil {
+				return err
+			}
+			return m.execute(ctx, conn, step)
+		})
 		if err != nil {
-			return applied, fmt.Errorf("failed to read file contents of %q: %v", path, err)
+			return applied, err
 		}
-		if txSupported(buf) {
-			err = transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
-				// execute migration in transaction
-				start := time.Now()
-				if _, err := tx.ExecContext(ctx, string(buf)); err != nil {
-					return &DriverError{"failed to execute SQL script " + path, err}
-				}
-				// log executed migration into history table
-				if _, err := tx.ExecContext(ctx, insertCmd, migration, time.Since(start)); err != nil {
-					return &DriverError{
-						fmt.Sprintf("failed to execute SQL statement %q", strings.Join(strings.Fields(insertCmd), " ")),
-						err,
-					}
-				}
-				return nil
+		applied = append(applied, step.Migration)
+	}
+
+	return applied, nil
+}
+
+// atomic returns an error if any step lacks transaction support and therefore
+// can't be applied in a single transaction.
+func atomic(steps []Step) error {
+	noTx := []string{}
+	for _, step := range steps {
+		if !step.Transaction {
+			noTx = append(noTx, step.Migration)
+		}
+	}
+	if len(noTx) > 0 {
+		return fmt.Errorf("failed to apply migrations in a single transaction: migrations without transaction support: %s", strings.Join(noTx, ", "))
+	}
+	return nil
+}
+
+// applyAtomic executes all pending migrations and the callbacks around them
+// in a single transaction.
+//
+// Either all migrations are applied or none: any failure rolls back every
+// migration of the run. The hooks of WithAfterEach are called before the
+// transaction commits.
+func (m *Migration) applyAtomic(ctx context.Context, db executor, steps []Step, callbacks map[string]string) (applied []string, err error) {
+	err = transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
+		if err := m.runCallback(ctx, tx, beforeMigrate, callbacks[beforeMigrate]); err != nil {
+			return err
+		}
+		for _, step := range steps {
+			err := m.around(ctx, step.Migration, func() error {
+				return m.execute(ctx, tx, step)
 			})
 			if err != nil {
-				return applied, err
+				return err
 			}
-		} else {
-			// execute migration with no transaction support
-			start := time.Now()
-			if _, err := db.ExecContext(ctx, string(buf)); err != nil {
-				return applied, &DriverError{"failed to execute SQL script " + path, err}
+		}
+		return m.runCallback(ctx, tx, afterMigrate, callbacks[afterMigrate])
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	applied = []string{}
+	for _, step := range steps {
+		applied = append(applied, step.Migration)
+	}
+	return applied, nil
+}
+
+// execute runs a single migration on q and logs it into the history table.
+//
+// Migrations with transaction support are executed with q being a *sql.Tx,
+// migrations without transaction support with q being the locked *sql.Conn.
+// SQL migrations without transaction support are executed statement by
+// statement.
+func (m *Migration) execute(ctx context.Context, q queryer, step Step) error {
+	if err := m.applySettings(ctx, q, step); err != nil {
+		return err
+	}
+	if !step.Transaction {
+		// session-level settings must not outlive a failed migration
+		defer func() {
+			if err := m.resetSettings(context.Background(), q, step); err != nil {
+				m.logger(err.Error())
 			}
-			// log executed migration into history table
-			if _, err := db.ExecContext(ctx, insertCmd, migration, time.Since(start)); err != nil {
-				return applied, &DriverError{
-					fmt.Sprintf("failed to execute SQL statement %q", strings.Join(strings.Fields(insertCmd), " ")),
-					err,
-				}
+		}()
+	}
+
+	start := time.Now()
+	switch {
+	case step.txFunc != nil:
+		if err := step.txFunc(ctx, q.(*sql.Tx)); err != nil {
+			return &DriverError{"failed to execute Go migration " + step.Migration, err}
+		}
+	case step.connFunc != nil:
+		if err := step.connFunc(ctx, q.(*sql.Conn)); err != nil {
+			return &DriverError{"failed to execute Go migration " + step.Migration, err}
+		}
+	case step.Transaction:
+		if _, err := q.ExecContext(ctx, step.SQL); err != nil {
+			merr := &MigrationError{Migration: step.Migration, Err: err}
+			merr.locate(step.SQL, step.SQL, 0)
+			return merr
+		}
+	default:
+		if err := m.executeStatements(ctx, q, step); err != nil {
+			return err
+		}
+	}
+	executionTime := time.Since(start)
+	if step.Transaction {
+		// the settings would apply to the following migrations in a single transaction
+		if err := m.resetSettings(ctx, q, step); err != nil {
+			return err
+		}
+	}
+
+	// log executed migration into history table
+	if !step.Transaction {
+		// the dirty entry must not vanish unless the new entry is recorded
+		return transaction(ctx, q.(executor), m.logger, func(tx *sql.Tx) error {
+			return m.record(ctx, tx, step, KindExecuted, executionTime)
+		})
+	}
+	return m.record(ctx, q, step, KindExecuted, executionTime)
+}
+
+// applySettings applies the settings of the migration, e.g. its lock_timeout.
+//
+// Settings of migrations with transaction support are local to the
+// transaction.
+func (m *Migration) applySettings(ctx context.Context, q queryer, step Step) error {
+	for _, s := range step.settings {
+		if _, err := q.ExecContext(ctx, `SELECT set_config($1, $2, $3);`, s.name, s.value, step.Transaction); err != nil {
+			return &DriverError{fmt.Sprintf("failed to set %s of migration %s", s.name, step.Migration), err}
+		}
+	}
+	return nil
+}
+
+// resetSettings resets the settings applied by applySettings.
+func (m *Migration) resetSettings(ctx context.Context, q queryer, step Step) error {
+	for _, s := range step.settings {
+		// RESET doesn't support parameters, but the names are no user input
+		if _, err := q.ExecContext(ctx, "RESET "+s.name+";"); err != nil {
+			return &DriverError{fmt.Sprintf("failed to reset %s of migration %s", s.name, step.Migration), err}
+		}
+	}
+	return nil
+}
+
+// executeStatements runs the statements of a migration without transaction
+// support one at a time, so a failure tells which statements took effect.
+func (m *Migration) executeStatements(ctx context.Context, q queryer, step Step) error {
+	statements := splitStatements(step.SQL)
+	for i, s := range statements {
+		start := time.Now()
+		if _, err := q.ExecContext(ctx, s.sql); err != nil {
+			merr := &MigrationError{
+				Migration: step.Migration,
+				Statement: i + 1,
+				StartLine: s.startLine,
+				EndLine:   s.endLine,
+				Err:       err,
 			}
+			merr.locate(step.SQL, s.sql, s.offset)
+			return merr
 		}
-		applied = append(applied, migration)
+		m.logger(fmt.Sprintf("%s: statement %d of %d (lines %d-%d) executed in %s", step.Migration, i+1, len(statements), s.startLine, s.endLine, time.Since(start)))
 	}
+	return nil
+}
 
-	return applied, nil
+// read returns the contents of the migration file.
+func (m *Migration) read(migration string) ([]byte, error) {
+	file, err := m.file(migration)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file contents of %q: %v", filepath.Join(m.path, filepath.FromSlash(file)), err)
+	}
+	return buf, nil
 }
 
+// file returns the path of the migration file relative to the migration
+// directory.
+func (m *Migration) file(migration string) (string, error) {
+	if m.paths == nil && !m.recursive {
+		return migration, nil
+	}
+	files := m.paths
+	if files == nil {
+		var err error
+		if files, err = m.files(); err != nil {
+			return "", err
+		}
+	}
+	if file, ok := files[migration]; ok {
+		return file, nil
+	}
+	return migration, nil
+}
+
+// available returns the names of all migration files and registered Go migrations.
 func (m *Migration) available() ([]string, error) {
-	nodes, err := ioutil.ReadDir(m.path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get list of migration files from %q: %v", m.path, err)
+	files := m.paths
+	if files == nil {
+		var err error
+		if files, err = m.files(); err != nil {
+			return nil, err
+		}
 	}
 
 	migrationFiles := []string{}
-	for _, node := range nodes {
+	for name := range files {
+		migrationFiles = append(migrationFiles, name)
+	}
+	sort.Strings(migrationFiles)
+
+	return m.withRegistered(migrationFiles)
+}
+
+// snapshot returns a copy of m for a single run, which walks the migration
+// directory once: reading migrations looks up their paths instead of walking
+// the directory tree again. The copy keeps m free of state shared by runs.
+func (m *Migration) snapshot() (*Migration, []string, error) {
+	files, err := m.files()
+	if err != nil {
+		return nil, nil, err
+	}
+	run := *m
+	run.paths = files
+	available, err := run.available()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &run, available, nil
+}
+
+// files returns the paths of all migration files relative to the migration
+// directory by their names.
+//
+// Subdirectories are only searched with WithRecursive. Migrations are
+// identified by their filename, which must therefore be unique across all
+// directories.
+func (m *Migration) files() (map[string]string, error) {
+	files := map[string]string{}
+	err := fs.WalkDir(m.fsys, ".", func(file string, node fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		if node.IsDir() {
-			continue
+			if file != "." && !m.recursive {
+				return fs.SkipDir
+			}
+			return nil
 		}
-		if filepath.Ext(node.Name()) != ".sql" {
-			continue
+		if filepath.Ext(node.Name()) != ".sql" || callback(node.Name()) {
+			return nil
 		}
-		migrationFiles = append(migrationFiles, node.Name())
+		if other, ok := files[node.Name()]; ok {
+			return fmt.Errorf("duplicate migration %q: found at %q and %q", node.Name(), other, file)
+		}
+		files[node.Name()] = file
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list of migration files from %q: %v", filepath.Join(m.path, "."), err)
 	}
-
-	return migrationFiles, nil
+	return files, nil
 }
 
 // initialized returns whether the history table for applied migrations
-// exists in the current schema.
-func (m *Migration) initialized(ctx context.Context, db *sql.DB) (bool, error) {
+// exists in the history schema (defaults to the current schema).
+func (m *Migration) initialized(ctx context.Context, db executor) (bool, error) {
 	cmd := `
 SELECT EXISTS (
 	SELECT 1
 	FROM pg_tables
-	WHERE schemaname = current_schema()
+	WHERE schemaname = COALESCE(NULLIF($2, ''), current_schema())
 	AND tablename = $1
 );`[1:]
-	row := db.QueryRowContext(ctx, cmd, m.table)
+	row := db.QueryRowContext(ctx, cmd, m.table, m.historySchema)
 
 	var exist bool
 	if err := row.Scan(&exist); err != nil {
@@ -208,7 +663,10 @@ SELECT EXISTS (
 
 // initialize creates the history table
 // which keeps track of all applied migrations.
-func (m *Migration) initialize(ctx context.Context, db *sql.DB) error {
+//
+// The table is created with the initial layout and upgraded to the current
+// layout within the same transaction.
+func (m *Migration) initialize(ctx context.Context, db executor) error {
 	stmt := `
 CREATE TABLE IF NOT EXISTS %s (
 	id integer PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
@@ -216,45 +674,38 @@ CREATE TABLE IF NOT EXISTS %s (
 	applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	execution_time REAL NOT NULL
 );`[1:]
-	cmd := fmt.Sprintf(stmt, m.table)
+	cmd := fmt.Sprintf(stmt, m.historyTable())
 
 	return transaction(ctx, db, m.logger, func(tx *sql.Tx) error {
+		if m.historySchema != "" {
+			if err := createSchema(ctx, tx, m.historySchema); err != nil {
+				return err
+			}
+		}
 		if _, err := tx.ExecContext(ctx, cmd); err != nil {
 			return &DriverError{"failed to create history table", err}
 		}
-		return nil
+		return m.upgradeLayout(ctx, tx, 1)
 	})
 }
 
-// applied returns all completed migrations from the history table.
-func (m *Migration) applied(ctx context.Context, db *sql.DB) ([]string, error) {
-	cmd := fmt.Sprintf(`SELECT migration FROM %s ORDER BY id ASC;`, m.table)
-	rows, err := db.QueryContext(ctx, cmd)
-	if err != nil {
-		return nil, &DriverError{"failed to query applied migrations", err}
-	}
-	defer logCloser(rows, m.logger)
-
-	applied := []string{}
-	for rows.Next() {
-		var m string
-		if err := rows.Scan(&m); err != nil {
-			return nil, &DriverError{"failed to row scan entry in query for applied migrations", err}
-		}
-		applied = append(applied, m)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, &DriverError{"failed to query applied migrations", err}
-	}
+// executor is implemented by *sql.DB and *sql.Conn.
+type executor interface {
+	queryer
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
 
-	return applied, nil
+// queryer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // transaction is a utility function to execute SQL inside a transaction
 //
 // see: https://stackoverflow.com/a/23502629
-func transaction(ctx context.Context, db *sql.DB, logger Logger, txFunc func(*sql.Tx) error) error {
+func transaction(ctx context.Context, db executor, logger Logger, txFunc func(*sql.Tx) error) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return &DriverError{"failed to begin db transaction", err}
@@ -281,13 +732,6 @@ func transaction(ctx context.Context, db *sql.DB, logger Logger, txFunc func(*sq
 	return err
 }
 
-// txSupported checks whether input is prefixed with `-- migrathor:no_transaction`
-//
-// Returns true if input has no transaction suppressor flag in first line.
-func txSupported(s []byte) bool {
-	return bytes.HasPrefix(bytes.TrimSpace(s), []byte(`-- migrathor:no_transaction`)) == false
-}
-
 // logCloser is a convenience logger for deferred execution.
 //
 // This fuction takes any struct implementing the io.Closer interface and closes
@@ -306,12 +750,167 @@ type Option func(*Migration)
 
 // WithHistoryTable tells New to use the provided name as default history table
 // name for applied migrations.
+//
+// The name may be schema-qualified, e.g. "meta.migrations", to keep the
+// history table apart from the target schema.
 func WithHistoryTable(name string) Option {
 	return func(c *Migration) {
 		c.table = name
 	}
 }
 
+// WithSchema tells New to run migrations against the provided schema.
+//
+// Apply creates the schema if it doesn't exist and sets the search_path of
+// its session to the schema while executing migrations. The history table is
+// created in the schema as well, unless WithHistoryTable names another one.
+func WithSchema(name string) Option {
+	return func(c *Migration) {
+		c.schema = name
+	}
+}
+
+// WithLockTimeout tells New how long Apply waits for the migration lock held
+// by another process before giving up with a *LockError (default one minute).
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(c *Migration) {
+		c.lockTimeout = timeout
+	}
+}
+
+// WithAllowOutOfOrder tells New whether pending migrations which are older
+// than the latest applied migration may be applied.
+//
+// Such migrations usually originate from merged feature branches. By default
+// Apply refuses to run them and returns an *OutOfOrderError.
+func WithAllowOutOfOrder(allow bool) Option {
+	return func(c *Migration) {
+		c.allowOutOfOrder = allow
+	}
+}
+
+// WithIgnoreMissing tells New whether applied migrations which aren't
+// available anymore may be ignored.
+//
+// By default Apply refuses to run if files of applied migrations were deleted
+// or renamed and returns a *MissingError.
+func WithIgnoreMissing(ignore bool) Option {
+	return func(c *Migration) {
+		c.ignoreMissing = ignore
+	}
+}
+
+// WithSingleTransaction tells New to apply all pending migrations of a run
+// in a single transaction.
+//
+// A failing migration rolls back all migrations of the run, so the database
+// is either fully upgraded or not at all. Apply refuses to run if any pending
+// migration is marked with `-- migrathor:no_transaction`. The callback files
+// _before_migrate.sql and _after_migrate.sql run inside that transaction.
+func WithSingleTransaction() Option {
+	return func(c *Migration) {
+		c.singleTx = true
+	}
+}
+
+// WithRecursive tells New to search subdirectories of the migration directory
+// for migration files as well, e.g. migrations/2019/03/.
+//
+// Migrations of all directories are ordered by their filenames. Filenames
+// must be unique across all directories. The path of each migration file is
+// recorded in the history table.
+func WithRecursive() Option {
+	return func(c *Migration) {
+		c.recursive = true
+	}
+}
+
+// WithVersion tells New to record the provided version of the application
+// running the migrations in the history table.
+func WithVersion(version string) Option {
+	return func(c *Migration) {
+		c.version = version
+	}
+}
+
+// WithDeploymentID tells New to record the provided identifier of the
+// current deployment (e.g. a release or pipeline id) in the history table.
+func WithDeploymentID(id string) Option {
+	return func(c *Migration) {
+		c.deploymentID = id
+	}
+}
+
+// WithVariables tells New to substitute placeholders like ${app_role} in
+// migration files with the provided values. Multiple calls are merged.
+//
+// Migrations using an undefined variable fail before any SQL is executed.
+// Variables are substituted everywhere, including string literals and
+// dollar-quoted bodies. Write ${$} for a literal $, e.g. ${$}{app_role} for
+// ${app_role}: unlike $${ it can't clash with dollar quoting.
+//
+// Checksums are computed on the files before substitution, so values may
+// differ between databases.
+func WithVariables(variables map[string]string) Option {
+	return func(c *Migration) {
+		if c.variables == nil {
+			c.variables = map[string]string{}
+		}
+		for name, value := range variables {
+			c.variables[name] = value
+		}
+	}
+}
+
+// WithTags tells New to select migrations by the tags of their
+// -- migrathor:tags directive, e.g. WithTags("prod") or WithTags("!seed").
+//
+// Migrations without tags are always selected, so are all migrations if no
+// tags are active. Migrations carrying a negated tag are skipped. If any
+// other tag is active, tagged migrations are only selected if they carry one
+// of the active tags. The active tags are recorded in the history table.
+func WithTags(tags ...string) Option {
+	return func(c *Migration) {
+		for _, tag := range tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				c.tags = append(c.tags, tag)
+			}
+		}
+	}
+}
+
+// WithBeforeEach tells New to call the hook before each pending migration is
+// executed.
+func WithBeforeEach(hook Hook) Option {
+	return func(c *Migration) {
+		c.beforeEach = hook
+	}
+}
+
+// WithAfterEach tells New to call the hook after each pending migration was
+// executed, successfully or not.
+func WithAfterEach(hook Hook) Option {
+	return func(c *Migration) {
+		c.afterEach = hook
+	}
+}
+
+// WithBeforeAll tells New to call the hook before the first pending migration
+// of a run is executed. Runs without pending migrations call no hooks.
+func WithBeforeAll(hook Hook) Option {
+	return func(c *Migration) {
+		c.beforeAll = hook
+	}
+}
+
+// WithAfterAll tells New to call the hook after the last pending migration of
+// a run was executed or the run failed.
+func WithAfterAll(hook Hook) Option {
+	return func(c *Migration) {
+		c.afterAll = hook
+	}
+}
+
 // WithLogger tells New to use the provided logger for internal logging.
 func WithLogger(logger Logger) Option {
 	return func(c *Migration) {
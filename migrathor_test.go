@@ -3,8 +3,10 @@ package migrathor
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -67,30 +70,6 @@ func cleanup(ctx context.Context, db *sql.DB, t *testing.T) {
 	}
 }
 
-func Test_txSupported(t *testing.T) {
-	tests := []string{
-		"-- migrathor:no_transaction\nVACUUM log;",
-		"  \n  -- migrathor:no_transaction",
-		"  -- migrathor:no_transaction    /* comment */",
-		"-- migrathor:no_transaction",
-	}
-	for _, tt := range tests {
-		if got := txSupported([]byte(tt)); got {
-			t.Errorf("txSupported(): transaction suppressor did not fire: %s", tt)
-		}
-	}
-	tests = []string{
-		"CREATE TABLE user();",
-		"CREATE TABLE user();\nDO DATABASE STUFF();",
-		"RANDOM ACCESS MEMORY;\n  -- migrathor:no_transaction /* suppressor not on first line */",
-	}
-	for _, tt := range tests {
-		if got := txSupported([]byte(tt)); got == false {
-			t.Errorf("txSupported(): transaction suppressor should not trigger on: %s", tt)
-		}
-	}
-}
-
 func TestMigration_Create(t *testing.T) {
 	dir, err := ioutil.TempDir("", "migrathor_test_")
 	if err != nil {
@@ -295,6 +274,293 @@ func TestMigration_available(t *testing.T) {
 	}
 }
 
+func TestNewFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_213554_add_users.sql":    {Data: []byte("INSERT INTO users (email, name) VALUES ('mi@ke.le', 'Mike');")},
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users ();")},
+		"ignored_artifact":                   {},
+		"sub/2019_03_06_000000_nested.sql":   {},
+	}
+	migration := NewFS(fsys)
+
+	got, err := migration.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("available()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	buf, err := migration.read("2019_03_05_173612_create_users.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "CREATE TABLE users ();" {
+		t.Errorf("read() returned wrong contents: %q", buf)
+	}
+
+	if _, err := migration.Create("stuff"); err == nil {
+		t.Error("Create() should fail for migrations read from fs.FS")
+	}
+}
+
+func TestWithRecursive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019/03/2019_03_05_213554_add_users.sql":       {Data: []byte("INSERT INTO users (email, name) VALUES ('mi@ke.le', 'Mike');")},
+		"2019/03/2019_03_05_173612_create_users.sql":    {Data: []byte("CREATE TABLE users ();")},
+		"billing/2019_03_05_200000_create_invoices.sql": {Data: []byte("CREATE TABLE invoices ();")},
+		"2019_03_06_000000_seed_users.sql":              {Data: []byte("INSERT INTO users DEFAULT VALUES;")},
+		"billing/README.md":                             {},
+	}
+	migration := NewFS(fsys, WithRecursive())
+
+	got, err := migration.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2019_03_05_173612_create_users.sql",
+		"2019_03_05_200000_create_invoices.sql",
+		"2019_03_05_213554_add_users.sql",
+		"2019_03_06_000000_seed_users.sql",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("available()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	steps, err := migration.plan(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for _, step := range steps {
+		files = append(files, step.file)
+	}
+	wantFiles := []string{
+		"2019/03/2019_03_05_173612_create_users.sql",
+		"billing/2019_03_05_200000_create_invoices.sql",
+		"2019/03/2019_03_05_213554_add_users.sql",
+		"2019_03_06_000000_seed_users.sql",
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("plan() files\ngot  %v\nwant %v\n", files, wantFiles)
+	}
+	if steps[1].SQL != "CREATE TABLE invoices ();" {
+		t.Errorf("plan() read wrong contents: %q", steps[1].SQL)
+	}
+
+	fsys["billing/2019_03_06_000000_seed_users.sql"] = &fstest.MapFile{}
+	_, err = migration.available()
+	if err == nil || !strings.Contains(err.Error(), `duplicate migration "2019_03_06_000000_seed_users.sql"`) {
+		t.Errorf("available() should fail for duplicate migration names, got %v", err)
+	}
+}
+
+// walkCounter counts the walks of the migration directory.
+type walkCounter struct {
+	fstest.MapFS
+	walks int
+}
+
+func (c *walkCounter) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		c.walks++
+	}
+	return c.MapFS.ReadDir(name)
+}
+
+func TestMigration_snapshot(t *testing.T) {
+	fsys := &walkCounter{MapFS: fstest.MapFS{}}
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("2019_03_05_%06d_migration.sql", i)
+		fsys.MapFS[fmt.Sprintf("%02d/%s", i%10, name)] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+	migration := NewFS(fsys, WithRecursive())
+
+	run, available, err := migration.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(available) != 100 {
+		t.Fatalf("snapshot() should find 100 migrations, got %d", len(available))
+	}
+	if _, err := run.pending(available, []Record{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run.plan(available); err != nil {
+		t.Fatal(err)
+	}
+	if fsys.walks != 1 {
+		t.Errorf("a run should walk the migration directory once, got %d walks", fsys.walks)
+	}
+	if migration.paths != nil {
+		t.Error("snapshot() should not modify the migration")
+	}
+}
+
+func TestApplyRecursive(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	fsys := fstest.MapFS{
+		"2019/2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users (name TEXT);")},
+		"2019_03_05_213554_add_users.sql":         {Data: []byte("INSERT INTO users VALUES ('Mike');")},
+	}
+	migration := NewFS(fsys, WithRecursive())
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range records {
+		got = append(got, r.Path)
+	}
+	want := []string{"2019/2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("History() paths\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func Test_outOfOrder(t *testing.T) {
+	records := []Record{{Migration: "2_b.sql"}, {Migration: "4_d.sql"}, {Migration: "1_a.sql"}}
+	pending := []string{"3_c.sql", "5_e.sql"}
+
+	got := outOfOrder(pending, records)
+	want := []string{"3_c.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outOfOrder()\ngot  %v\nwant %v\n", got, want)
+	}
+	if got := outOfOrder(pending, []Record{}); len(got) != 0 {
+		t.Errorf("outOfOrder() without applied migrations should be empty, got %v", got)
+	}
+
+	// hotfixes marked as applied by hand don't count
+	records = append(records, Record{Migration: "6_f.sql", Kind: KindManual})
+	if got := outOfOrder(pending, records); !reflect.DeepEqual(got, want) {
+		t.Errorf("outOfOrder() with manual entry\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestApplyOutOfOrder(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "2019_03_06_000000_create_log.sql"), []byte(`CREATE TABLE log ();`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(dir).Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	// merge an older migration from a feature branch
+	name := "2019_03_05_000000_create_branch.sql"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(`CREATE TABLE branch ();`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(dir).Apply(ctx, database)
+	oerr, ok := err.(*OutOfOrderError)
+	if !ok {
+		t.Fatalf("Apply() should return *OutOfOrderError, got %v", err)
+	}
+	if want := []string{name}; !reflect.DeepEqual(oerr.Migrations, want) {
+		t.Errorf("OutOfOrderError.Migrations\ngot  %v\nwant %v\n", oerr.Migrations, want)
+	}
+
+	got, err := New(dir, WithAllowOutOfOrder(true)).Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{name}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestMigration_applyAtomicRefusesNoTransaction(t *testing.T) {
+	hooked := false
+	hook := func(ctx context.Context, migration string, duration time.Duration, err error) {
+		hooked = true
+	}
+	migration := New("testdata", WithSingleTransaction(), WithBeforeAll(hook), WithAfterAll(hook))
+	steps := []Step{
+		{Migration: "2019_03_05_173612_create_users.sql", Transaction: true},
+		{Migration: "2019_03_05_213554_add_users.sql", Transaction: false},
+	}
+	callbacks := map[string]string{beforeMigrate: "SELECT 1;"}
+	// refused before touching the database
+	got, err := migration.apply(context.Background(), nil, steps, callbacks)
+	if err == nil {
+		t.Fatal("apply() should refuse migrations without transaction support in single transaction mode")
+	}
+	if len(got) != 0 {
+		t.Errorf("apply() should not apply anything, got %v", got)
+	}
+	if hooked {
+		t.Error("apply() should refuse migrations before calling any hook")
+	}
+}
+
+func TestApplySingleTransaction(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"2019_03_06_000001_create_log.sql": `CREATE TABLE log (id bigserial PRIMARY KEY);`,
+		"2019_03_06_000002_broken.sql":     `CREATE TABLEtypo broken ();`,
+	}
+	for name, sql := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(sql), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migration := New(dir, WithSingleTransaction())
+	if _, err := migration.Apply(ctx, database); err == nil {
+		t.Fatal("Apply() returned no error, should have because of invalid sql")
+	}
+
+	// the first migration must have been rolled back as well
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("History() should be empty after failed single transaction, got %v", records)
+	}
+	var exist bool
+	if err := database.QueryRowContext(ctx, `SELECT to_regclass('log') IS NOT NULL;`).Scan(&exist); err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Error("table log should have been rolled back")
+	}
+}
+
 type closer struct{}
 
 func (closer) Close() error {
@@ -322,3 +588,13 @@ func TestNew(t *testing.T) {
 	}
 	_ = New("testdata", WithHistoryTable(table), WithFilenameFormatter(formatter), WithLogger(logger))
 }
+
+func TestMigration_pendingDirty(t *testing.T) {
+	available := []string{"1_a.sql", "2_b.sql", "3_c.sql"}
+	records := []Record{{Migration: "1_a.sql"}, {Migration: "2_b.sql", Dirty: true}}
+
+	_, err := New("").pending(available, records)
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("pending() should fail with ErrDirty, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Step is a single pending migration of an execution plan.
+type Step struct {
+	// Migration is the filename of the migration.
+	Migration string
+
+	// Transaction tells whether the migration runs inside a transaction.
+	Transaction bool
+
+	// SQL contains the statements to be executed with all variables
+	// substituted (empty for Go migrations).
+	SQL string
+
+	file     string
+	checksum string
+	settings []setting
+	txFunc   TxFunc
+	connFunc ConnFunc
+}
+
+// Plan returns the pending migrations in order of execution without
+// applying them.
+//
+// Plan is read-only: no SQL of any migration is executed and the history
+// table isn't created. Plan fails for the same reasons Apply would fail
+// before executing the first migration, e.g. edited migrations.
+func (m *Migration) Plan(ctx context.Context, db *sql.DB) ([]Step, error) {
+	return m.planTarget(ctx, db, target{})
+}
+
+// PlanTo returns the execution plan of ApplyTo without applying it.
+func (m *Migration) PlanTo(ctx context.Context, db *sql.DB, target string) ([]Step, error) {
+	if target == "" {
+		return nil, fmt.Errorf("failed to plan migrations: empty target migration")
+	}
+	return m.planTarget(ctx, db, targetMigration(target))
+}
+
+// PlanSteps returns the execution plan of ApplySteps without applying it.
+func (m *Migration) PlanSteps(ctx context.Context, db *sql.DB, n int) ([]Step, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("failed to plan migrations: steps must be positive, got %d", n)
+	}
+	return m.planTarget(ctx, db, targetSteps(n))
+}
+
+func (m *Migration) planTarget(ctx context.Context, db *sql.DB, t target) ([]Step, error) {
+	run, available, err := m.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := m.historyIfExists(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := run.pending(available, records)
+	if err != nil {
+		return nil, err
+	}
+	pending, err = t.limit(pending, available, records)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := run.plan(pending)
+	if err != nil {
+		return nil, err
+	}
+	if m.singleTx {
+		if err := atomic(steps); err != nil {
+			return nil, err
+		}
+	}
+	// callbacks aren't part of the plan, but must not fail Apply either
+	if _, err := m.callbacks(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// plan reads the pending migrations into an execution plan.
+func (m *Migration) plan(pending []string) ([]Step, error) {
+	steps := []Step{}
+	for _, migration := range pending {
+		if g, ok := m.registeredFunc(migration); ok {
+			steps = append(steps, Step{
+				Migration:   migration,
+				Transaction: g.txFunc != nil,
+				txFunc:      g.txFunc,
+				connFunc:    g.connFunc,
+			})
+			continue
+		}
+		buf, err := m.read(migration)
+		if err != nil {
+			return nil, err
+		}
+		// checksum the raw file, so values may differ between databases
+		sql, err := m.substitute(migration, string(buf))
+		if err != nil {
+			return nil, err
+		}
+		directives, err := ParseDirectives(migration, buf)
+		if err != nil {
+			return nil, err
+		}
+		file, err := m.file(migration)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, Step{
+			Migration:   migration,
+			Transaction: !directives.NoTransaction,
+			SQL:         sql,
+			file:        file,
+			checksum:    checksum(buf),
+			settings:    directives.settings(),
+		})
+	}
+	return steps, nil
+}
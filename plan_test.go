@@ -0,0 +1,68 @@
+package migrathor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMigration_Plan(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+
+	steps, err := migration.Plan(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []Step{}
+	for _, s := range steps {
+		got = append(got, Step{Migration: s.Migration, Transaction: s.Transaction})
+	}
+	want := []Step{
+		{Migration: "2019_03_05_173612_create_users.sql", Transaction: true},
+		{Migration: "2019_03_05_213554_add_users.sql", Transaction: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// plan must not touch the schema
+	exist, err := migration.initialized(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Fatal("history table shouldn't exist but does")
+	}
+}
+
+func TestMigration_plan(t *testing.T) {
+	migration := New("testdata")
+
+	steps, err := migration.plan([]string{"2019_03_05_213554_add_users.sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 {
+		t.Fatalf("plan() returned %d steps, want 1", len(steps))
+	}
+	if steps[0].Transaction {
+		t.Error("plan(): migration with no_transaction suppressor should run without transaction")
+	}
+	buf, err := migration.read("2019_03_05_213554_add_users.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[0].SQL != string(buf) || steps[0].checksum != checksum(buf) {
+		t.Error("plan(): step doesn't match migration contents")
+	}
+
+	if _, err := migration.plan([]string{"doesnotexist.sql"}); err == nil {
+		t.Error("plan() should fail for unreadable migrations")
+	}
+}
@@ -0,0 +1,88 @@
+package migrathor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// positioner is implemented by driver errors exposing the fields of the
+// server's error response, e.g. *pq.Error.
+type positioner interface {
+	Get(field byte) string
+}
+
+// position returns the error position reported by the server, a 1-based
+// character offset into the executed query, or 0 if unknown.
+func position(err error) int {
+	p, ok := err.(positioner)
+	if !ok {
+		return 0
+	}
+	pos, perr := strconv.Atoi(p.Get('P'))
+	if perr != nil || pos < 1 {
+		return 0
+	}
+	return pos
+}
+
+// byteOffset returns the byte offset of the 1-based character position pos
+// within query or -1 if pos is out of range.
+//
+// Errors at the end of input (e.g. an unclosed parenthesis) are reported one
+// past the last character and map to len(query).
+func byteOffset(query string, pos int) int {
+	for offset := range query {
+		pos--
+		if pos == 0 {
+			return offset
+		}
+	}
+	if pos == 1 {
+		return len(query)
+	}
+	return -1
+}
+
+// locate returns the 1-based line and column (in characters) of the byte
+// offset within script and an excerpt of the line with a caret below the
+// column.
+func locate(script string, offset int) (line, column int, excerpt string) {
+	start := strings.LastIndexByte(script[:offset], '\n') + 1
+	end := strings.IndexByte(script[offset:], '\n')
+	if end < 0 {
+		end = len(script)
+	} else {
+		end += offset
+	}
+	text := strings.TrimRight(script[start:end], "\r")
+
+	line = strings.Count(script[:start], "\n") + 1
+	column = utf8.RuneCountInString(script[start:offset]) + 1
+
+	// keep tabs, so the caret lines up with the text
+	indent := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, script[start:offset])
+	gutter := strconv.Itoa(line)
+	excerpt = fmt.Sprintf("%s | %s\n%s | %s^", gutter, text, strings.Repeat(" ", len(gutter)), indent)
+	return line, column, excerpt
+}
+
+// locate sets the line, column and excerpt of the error position reported
+// by the server for query, which starts at offset within script.
+func (e *MigrationError) locate(script, query string, offset int) {
+	pos := position(e.Err)
+	if pos == 0 {
+		return
+	}
+	i := byteOffset(query, pos)
+	if i < 0 {
+		return
+	}
+	e.Line, e.Column, e.Excerpt = locate(script, offset+i)
+}
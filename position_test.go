@@ -0,0 +1,87 @@
+package migrathor
+
+import (
+	"testing"
+)
+
+// serverError mimics a driver error exposing the error position like *pq.Error.
+type serverError string
+
+func (e serverError) Error() string { return "syntax error" }
+
+func (e serverError) Get(field byte) string {
+	if field == 'P' {
+		return string(e)
+	}
+	return ""
+}
+
+func Test_locate(t *testing.T) {
+	script := "-- migrathor:no_transaction\nCREATE TABLE users ();\n\tALTER TABLE users ADD COLUM name TEXT;\n"
+	line, column, excerpt := locate(script, 74)
+	if line != 3 || column != 24 {
+		t.Errorf("locate() = %d:%d, want 3:24", line, column)
+	}
+	want := "3 | \tALTER TABLE users ADD COLUM name TEXT;\n  | \t                      ^"
+	if excerpt != want {
+		t.Errorf("locate() excerpt\ngot\n%s\nwant\n%s", excerpt, want)
+	}
+}
+
+func Test_byteOffset(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		want  int
+	}{
+		{"SELECT (", 1, 0},
+		{"SELECT (", 8, 7},
+		{"SELECT (", 9, 8}, // syntax error at end of input
+		{"SELECT (", 10, -1},
+		{"SELECT 'Jürgen' (", 18, 18},
+		{"", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := byteOffset(tt.query, tt.pos); got != tt.want {
+			t.Errorf("byteOffset(%q, %d) = %d, want %d", tt.query, tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestMigrationError_locate(t *testing.T) {
+	// positions are counted in characters
+	script := "INSERT INTO users (name) VALUES ('Jürgen');\nSELEC 1;\n"
+	statements := splitStatements(script)
+
+	err := &MigrationError{Migration: "test.sql", Err: serverError("45")}
+	err.locate(script, script, 0)
+	if err.Line != 2 || err.Column != 1 {
+		t.Errorf("locate() = %d:%d, want 2:1", err.Line, err.Column)
+	}
+
+	err = &MigrationError{Migration: "test.sql", Statement: 2, Err: serverError("1")}
+	err.locate(script, statements[1].sql, statements[1].offset)
+	if err.Line != 2 || err.Column != 1 {
+		t.Errorf("locate() = %d:%d, want 2:1", err.Line, err.Column)
+	}
+
+	// syntax error at end of input
+	script = "CREATE TABLE users (\n\tname TEXT"
+	err = &MigrationError{Migration: "test.sql", Err: serverError("32")}
+	err.locate(script, script, 0)
+	if err.Line != 2 || err.Column != 11 {
+		t.Errorf("locate() = %d:%d, want 2:11", err.Line, err.Column)
+	}
+	if want := "2 | \tname TEXT\n  | \t         ^"; err.Excerpt != want {
+		t.Errorf("locate() excerpt\ngot\n%s\nwant\n%s", err.Excerpt, want)
+	}
+
+	// unknown position
+	for _, uerr := range []error{serverError(""), serverError("1000"), &DriverError{"no position", nil}} {
+		err = &MigrationError{Migration: "test.sql", Err: uerr}
+		err.locate(script, script, 0)
+		if err.Line != 0 || err.Excerpt != "" {
+			t.Errorf("locate() should not locate error %#v", uerr)
+		}
+	}
+}
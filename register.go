@@ -0,0 +1,86 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TxFunc is a Go migration executed inside a transaction.
+type TxFunc func(ctx context.Context, tx *sql.Tx) error
+
+// ConnFunc is a Go migration executed without transaction support.
+type ConnFunc func(ctx context.Context, conn *sql.Conn) error
+
+// goMigration is a registered Go migration.
+type goMigration struct {
+	name     string
+	txFunc   TxFunc
+	connFunc ConnFunc
+}
+
+// Register adds a Go migration executed inside a transaction.
+//
+// Go migrations are ordered by name together with the sql files and are
+// recorded in the same history table. The name should therefore follow the
+// filename format (without extension), e.g. "2019_03_06_120000_backfill_slugs".
+//
+//	migration.Register("2019_03_06_120000_backfill_slugs", func(ctx context.Context, tx *sql.Tx) error {
+//		_, err := tx.ExecContext(ctx, "UPDATE users SET slug = $1 WHERE id = $2;", slug, id)
+//		return err
+//	})
+//
+// Invalid or duplicate names are reported by Apply.
+func (m *Migration) Register(name string, fn TxFunc) {
+	m.registered = append(m.registered, goMigration{name: name, txFunc: fn})
+}
+
+// RegisterNoTx adds a Go migration executed without transaction support.
+//
+// The migration receives the connection holding the migration lock, so it
+// runs with the search_path of WithSchema like SQL migrations. The connection
+// must not be closed and session settings changed by the migration should be
+// reset by it.
+func (m *Migration) RegisterNoTx(name string, fn ConnFunc) {
+	m.registered = append(m.registered, goMigration{name: name, connFunc: fn})
+}
+
+// withRegistered returns the migration files merged with the names of all
+// registered Go migrations.
+func (m *Migration) withRegistered(files []string) ([]string, error) {
+	seen := map[string]string{}
+	for _, file := range files {
+		seen[migrationKey(file)] = file
+	}
+
+	available := append([]string{}, files...)
+	for _, g := range m.registered {
+		if g.name == "" || (g.txFunc == nil && g.connFunc == nil) {
+			return nil, fmt.Errorf("invalid Go migration %q: name and func are required", g.name)
+		}
+		if other, ok := seen[migrationKey(g.name)]; ok {
+			return nil, fmt.Errorf("duplicate migration %q: conflicts with %q", g.name, other)
+		}
+		seen[migrationKey(g.name)] = g.name
+		available = append(available, g.name)
+	}
+
+	return available, nil
+}
+
+// registeredFunc returns the registered Go migration with the given name.
+func (m *Migration) registeredFunc(name string) (goMigration, bool) {
+	for _, g := range m.registered {
+		if g.name == name {
+			return g, true
+		}
+	}
+	return goMigration{}, false
+}
+
+// migrationKey returns the case-insensitive name of a migration without extension.
+func migrationKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
@@ -0,0 +1,115 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestMigration_Register(t *testing.T) {
+	noop := func(ctx context.Context, tx *sql.Tx) error { return nil }
+	noopConn := func(ctx context.Context, conn *sql.Conn) error { return nil }
+
+	migration := New("testdata")
+	migration.Register("2019_03_05_200000_backfill_users", noop)
+	migration.RegisterNoTx("2019_03_05_190000_vacuum_users", noopConn)
+
+	got, err := migration.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2019_03_05_173612_create_users.sql",
+		"2019_03_05_213554_add_users.sql",
+		"2019_03_05_200000_backfill_users",
+		"2019_03_05_190000_vacuum_users",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("available()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	steps, err := migration.plan([]string{"2019_03_05_190000_vacuum_users", "2019_03_05_200000_backfill_users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[0].Transaction || steps[0].connFunc == nil {
+		t.Error("plan(): Go migration registered with RegisterNoTx should run without transaction")
+	}
+	if !steps[1].Transaction || steps[1].txFunc == nil {
+		t.Error("plan(): Go migration registered with Register should run inside transaction")
+	}
+
+	// duplicate of a migration file
+	migration.Register("2019_03_05_173612_create_users", noop)
+	if _, err := migration.available(); err == nil {
+		t.Error("available() should fail for duplicate migration names")
+	}
+
+	// missing func
+	migration = New("testdata")
+	migration.Register("2019_03_05_200000_backfill_users", nil)
+	if _, err := migration.available(); err == nil {
+		t.Error("available() should fail for Go migration without func")
+	}
+}
+
+func TestApplyRegistered(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+	// runs between create_users and add_users
+	migration.Register("2019_03_05_200000_add_slugs", func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `ALTER TABLE users ADD COLUMN slug TEXT;`)
+		return err
+	})
+
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2019_03_05_173612_create_users.sql",
+		"2019_03_05_200000_add_slugs",
+		"2019_03_05_213554_add_users.sql",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+	if err := migration.Verify(ctx, database); err != nil {
+		t.Errorf("Verify() failed with Go migrations: %v", err)
+	}
+}
+
+func TestApplyRegisteredNoTxSchema(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+	defer func() {
+		if _, err := database.ExecContext(ctx, `DROP SCHEMA IF EXISTS app CASCADE;`); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	migration := New("testdata", WithSchema("app"))
+	var schema string
+	migration.RegisterNoTx("2019_03_05_200000_vacuum_users", func(ctx context.Context, conn *sql.Conn) error {
+		if err := conn.QueryRowContext(ctx, `SELECT current_schema();`).Scan(&schema); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `VACUUM users;`)
+		return err
+	})
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if schema != "app" {
+		t.Errorf("Go migration without transaction ran in schema %q, want app", schema)
+	}
+}
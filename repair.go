@@ -0,0 +1,183 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Actions recorded in the audit table.
+const (
+	actionMarkApplied = "mark-applied"
+	actionUnmark      = "unmark"
+	actionResolve     = "resolve-applied"
+	actionReset       = "resolve-pending"
+)
+
+// MarkApplied records the available migration as applied without executing
+// it and returns its filename.
+//
+// MarkApplied is meant for repairs, e.g. after a hotfix was applied by hand.
+// The migration is identified like the target of ApplyTo and must not be
+// applied already (unless it is repeatable). The change is logged into the
+// audit table next to the history table.
+//
+// Migrations marked as applied don't count for the out of order check of
+// Apply: pending migrations older than the hotfix are still applied.
+func (m *Migration) MarkApplied(ctx context.Context, db *sql.DB, migration string) (marked string, err error) {
+	err = m.exclusive(ctx, db, func(conn *sql.Conn) error {
+		marked, err = m.repair(ctx, conn, migration, actionMarkApplied)
+		return err
+	})
+	return marked, err
+}
+
+// Unmark removes the available migration from the history table, so the
+// next Apply executes it again, and returns its filename.
+//
+// Unmark is meant for repairs, e.g. after a migration was reverted by hand.
+// The migration is identified like the target of ApplyTo and must be
+// applied. The change is logged into the audit table next to the history
+// table.
+//
+// Apply refuses to execute a migration older than the latest applied one
+// (see WithAllowOutOfOrder). Unmark therefore refuses migrations older than
+// the latest applied one as well, unless WithAllowOutOfOrder is set, in which
+// case Apply needs it too.
+func (m *Migration) Unmark(ctx context.Context, db *sql.DB, migration string) (unmarked string, err error) {
+	err = m.exclusive(ctx, db, func(conn *sql.Conn) error {
+		unmarked, err = m.repair(ctx, conn, migration, actionUnmark)
+		return err
+	})
+	return unmarked, err
+}
+
+// Resolve clears the dirty state of a migration without transaction
+// support which failed halfway, and returns its filename.
+//
+// The operator has to bring the database into a known state first: either
+// complete the migration by hand and resolve it as applied, or revert its
+// changes by hand and resolve it as not applied, so the next Apply executes
+// it again. The change is logged into the audit table next to the history
+// table.
+func (m *Migration) Resolve(ctx context.Context, db *sql.DB, migration string, applied bool) (resolved string, err error) {
+	action := actionReset
+	if applied {
+		action = actionResolve
+	}
+	err = m.exclusive(ctx, db, func(conn *sql.Conn) error {
+		resolved, err = m.repair(ctx, conn, migration, action)
+		return err
+	})
+	return resolved, err
+}
+
+// repair executes the action on the history table and logs it into the
+// audit table within a single transaction.
+func (m *Migration) repair(ctx context.Context, conn executor, name, action string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("failed to %s migration: empty migration", action)
+	}
+	if err := m.prepare(ctx, conn); err != nil {
+		return "", err
+	}
+
+	run, available, err := m.snapshot()
+	if err != nil {
+		return "", err
+	}
+	migration, err := resolve(name, available)
+	if err != nil {
+		return "", err
+	}
+
+	records, err := m.history(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	applied := len(filterExcept([]string{migration}, names(records))) == 0
+	dirty := len(filterExcept([]string{migration}, dirtyMigrations(records))) == 0
+
+	step := Step{Migration: migration}
+	if _, ok := m.registeredFunc(migration); !ok {
+		buf, err := run.read(migration)
+		if err != nil {
+			return "", err
+		}
+		if step.file, err = run.file(migration); err != nil {
+			return "", err
+		}
+		step.checksum = checksum(buf)
+	}
+
+	err = transaction(ctx, conn, m.logger, func(tx *sql.Tx) error {
+		switch action {
+		case actionMarkApplied:
+			if applied && !repeatable(migration) {
+				return fmt.Errorf("failed to mark migration %q as applied: migration was already applied", migration)
+			}
+			if err := m.record(ctx, tx, step, KindManual, 0); err != nil {
+				return err
+			}
+		case actionUnmark:
+			if !applied {
+				return fmt.Errorf("failed to unmark migration %q: migration was not applied", migration)
+			}
+			if last := latest(filterRecords(records, migration)); migration < last && !repeatable(migration) && !m.allowOutOfOrder {
+				return fmt.Errorf("failed to unmark migration %q: Apply would refuse it as out of order behind %q unless out of order migrations are allowed", migration, last)
+			}
+			cmd := fmt.Sprintf(`DELETE FROM %s WHERE lower(migration) = lower($1);`, m.historyTable())
+			if _, err := tx.ExecContext(ctx, cmd, migration); err != nil {
+				return &DriverError{fmt.Sprintf("failed to execute SQL statement %q", cmd), err}
+			}
+		case actionResolve, actionReset:
+			if !dirty {
+				return fmt.Errorf("failed to resolve migration %q: migration is not dirty", migration)
+			}
+			cmd := fmt.Sprintf(`UPDATE %s SET dirty = false WHERE lower(migration) = lower($1);`, m.historyTable())
+			if action == actionReset {
+				cmd = fmt.Sprintf(`DELETE FROM %s WHERE lower(migration) = lower($1);`, m.historyTable())
+			}
+			if _, err := tx.ExecContext(ctx, cmd, migration); err != nil {
+				return &DriverError{fmt.Sprintf("failed to execute SQL statement %q", cmd), err}
+			}
+		}
+		return m.audit(ctx, tx, step, action)
+	})
+	if err != nil {
+		return "", err
+	}
+	return migration, nil
+}
+
+// filterRecords returns all records except the ones of the migration.
+func filterRecords(records []Record, migration string) []Record {
+	filtered := []Record{}
+	for _, r := range records {
+		if !strings.EqualFold(r.Migration, migration) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// audit logs a manual change of the history table into the audit table.
+func (m *Migration) audit(ctx context.Context, db queryer, step Step, action string) error {
+	cmd := fmt.Sprintf(`
+INSERT INTO %s (migration, action, checksum, performed_by, application_name, hostname, version, deployment_id)
+VALUES ($1, $2, NULLIF($3, ''), current_user, current_setting('application_name'), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''));`[1:], m.auditTable())
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		m.logger("failed to get hostname: " + err.Error())
+	}
+	if _, err := db.ExecContext(ctx, cmd, step.Migration, action, step.checksum, hostname, m.version, m.deploymentID); err != nil {
+		return &DriverError{
+			fmt.Sprintf("failed to execute SQL statement %q", strings.Join(strings.Fields(cmd), " ")),
+			err,
+		}
+	}
+	return nil
+}
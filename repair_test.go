@@ -0,0 +1,230 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigration_MarkApplied(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+	if _, err := migration.MarkApplied(ctx, database, "2019_03_06"); err == nil {
+		t.Error("MarkApplied() should fail for unknown migration")
+	}
+
+	got, err := migration.MarkApplied(ctx, database, "2019_03_05_173612")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2019_03_05_173612_create_users.sql"; got != want {
+		t.Errorf("MarkApplied()\ngot  %v\nwant %v\n", got, want)
+	}
+	if _, err := migration.MarkApplied(ctx, database, "2019_03_05_173612"); err == nil {
+		t.Error("MarkApplied() should fail for applied migration")
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Kind != KindManual {
+		t.Errorf("History() should contain a single manual entry, got %v", records)
+	}
+
+	if _, err := migration.Unmark(ctx, database, "2019_03_05_213554"); err == nil {
+		t.Error("Unmark() should fail for pending migration")
+	}
+	if _, err := migration.Unmark(ctx, database, "2019_03_05_173612_create_users"); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = migration.History(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("History() should be empty after Unmark(), got %v", records)
+	}
+
+	// every manual change is audited
+	rows, err := database.QueryContext(ctx, `SELECT migration, action FROM migrations_audit ORDER BY id;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	audit := []string{}
+	for rows.Next() {
+		var migration, action string
+		if err := rows.Scan(&migration, &action); err != nil {
+			t.Fatal(err)
+		}
+		audit = append(audit, action+" "+migration)
+	}
+	want := []string{
+		"mark-applied 2019_03_05_173612_create_users.sql",
+		"unmark 2019_03_05_173612_create_users.sql",
+	}
+	if !reflect.DeepEqual(audit, want) {
+		t.Errorf("audit table\ngot  %v\nwant %v\n", audit, want)
+	}
+}
+
+func TestMigration_Resolve(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := "2019_03_05_173612_create_log.sql"
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first statement succeeds, the second one fails
+	write("-- migrathor:no_transaction\nCREATE TABLE log ();\nCREATE TABLE log ();")
+	migration := New(dir)
+	_, err = migration.Apply(ctx, database)
+	merr, ok := err.(*MigrationError)
+	if !ok {
+		t.Fatalf("Apply() should fail with *MigrationError, got %v", err)
+	}
+	if merr.Statement != 2 || merr.StartLine != 3 {
+		t.Errorf("MigrationError should point to statement 2 on line 3, got %v", merr)
+	}
+	if _, err := migration.Apply(ctx, database); !errors.Is(err, ErrDirty) {
+		t.Fatalf("Apply() should fail with ErrDirty, got %v", err)
+	}
+	status, err := migration.Status(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].State != StateDirty {
+		t.Errorf("Status() should report dirty migration, got %v", status)
+	}
+
+	// revert by hand and retry
+	if _, err := database.ExecContext(ctx, `DROP TABLE IF EXISTS log;`); err != nil {
+		t.Fatal(err)
+	}
+	write("-- migrathor:no_transaction\nCREATE TABLE log ();")
+	if _, err := migration.Resolve(ctx, database, name, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migration.Resolve(ctx, database, name, false); err == nil {
+		t.Error("Resolve() should fail for migration which isn't dirty")
+	}
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{name}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Dirty {
+		t.Errorf("History() should contain a single clean entry, got %v", records)
+	}
+}
+
+func TestApplyNoTxKeepsDirtyUntilRecorded(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := NewFS(fstest.MapFS{})
+	// succeeds, but makes recording the clean entry fail afterwards
+	name := "2019_03_05_173612_only_dirty"
+	migration.RegisterNoTx(name, func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `ALTER TABLE migrations ADD CONSTRAINT only_dirty CHECK (dirty) NOT VALID;`)
+		return err
+	})
+	if _, err := migration.Apply(ctx, database); err == nil {
+		t.Fatal("Apply() should fail to record the migration")
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Dirty {
+		t.Errorf("History() should keep the dirty entry, got %v", records)
+	}
+	if _, err := migration.Apply(ctx, database); !errors.Is(err, ErrDirty) {
+		t.Errorf("Apply() should fail with ErrDirty instead of executing the migration again, got %v", err)
+	}
+}
+
+func TestMarkAppliedUnmarkOutOfOrder(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users (name TEXT);")},
+		"2019_03_05_213554_add_users.sql":    {Data: []byte("INSERT INTO users VALUES ('Mike');")},
+		"2019_03_06_090000_hotfix.sql":       {Data: []byte("CREATE INDEX users_name ON users (name);")},
+	}
+	migration := NewFS(fsys)
+	if _, err := migration.ApplySteps(ctx, database, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// hotfix N+2 was applied by hand while N+1 is still pending
+	if _, err := database.ExecContext(ctx, `CREATE INDEX users_name ON users (name);`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migration.MarkApplied(ctx, database, "2019_03_06_090000"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatalf("Apply() should apply migrations pending before a hotfix: %v", err)
+	}
+	if want := []string{"2019_03_05_213554_add_users.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// unmarking an older migration would leave it out of order
+	if _, err := database.ExecContext(ctx, `DROP TABLE users;`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migration.Unmark(ctx, database, "2019_03_05_173612"); err == nil {
+		t.Fatal("Unmark() should refuse migration older than the latest applied one")
+	}
+	migration = NewFS(fsys, WithAllowOutOfOrder(true))
+	if _, err := migration.Unmark(ctx, database, "2019_03_05_173612"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2019_03_05_173612_create_users.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package migrathor
+
+import "strings"
+
+// repeatablePrefix marks migration files which are executed again whenever
+// their contents change, e.g. R_timestamp_created.sql.
+//
+// Repeatable migrations suit objects which are redefined as a whole, like
+// views, functions and triggers. They are executed after all versioned
+// migrations in order of their names. The history table keeps a single
+// entry with the checksum of the last execution for each of them.
+const repeatablePrefix = "R_"
+
+// repeatable returns whether migration is a repeatable migration.
+func repeatable(migration string) bool {
+	return strings.HasPrefix(migration, repeatablePrefix)
+}
+
+// versioned returns all migrations which are not repeatable.
+func versioned(migrations []string) []string {
+	return filter(migrations, func(s string) bool { return !repeatable(s) })
+}
+
+// outdated returns all available repeatable migrations which were not
+// applied yet or whose contents changed since their last execution.
+//
+// Registered Go migrations have no checksum and are executed only once.
+func (m *Migration) outdated(available []string, records []Record) ([]string, error) {
+	checksums := map[string]string{}
+	for _, r := range records {
+		checksums[strings.ToLower(r.Migration)] = r.Checksum
+	}
+
+	outdated := []string{}
+	for _, migration := range available {
+		if !repeatable(migration) {
+			continue
+		}
+		sum, applied := checksums[strings.ToLower(migration)]
+		if !applied {
+			outdated = append(outdated, migration)
+			continue
+		}
+		if _, ok := m.registeredFunc(migration); ok {
+			continue
+		}
+		buf, err := m.read(migration)
+		if err != nil {
+			return nil, err
+		}
+		if checksum(buf) != sum {
+			outdated = append(outdated, migration)
+		}
+	}
+	return outdated, nil
+}
@@ -0,0 +1,123 @@
+package migrathor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigration_pendingRepeatable(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users ();")},
+		"2019_03_05_213554_create_log.sql":   {Data: []byte("CREATE TABLE log ();")},
+		"R_users_view.sql":                   {Data: []byte("CREATE OR REPLACE VIEW active_users AS SELECT 1;")},
+		"R_timestamp_created.sql":            {Data: []byte("CREATE OR REPLACE FUNCTION timestamp_created() ...;")},
+		"R_unchanged.sql":                    {Data: []byte("CREATE OR REPLACE VIEW unchanged AS SELECT 1;")},
+	}
+	migration := NewFS(fsys)
+	available, err := migration.available()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []Record{
+		{Migration: "2019_03_05_173612_create_users.sql", Checksum: checksum(fsys["2019_03_05_173612_create_users.sql"].Data)},
+		{Migration: "R_users_view.sql", Checksum: checksum([]byte("CREATE VIEW active_users AS SELECT 0;"))},
+		{Migration: "R_unchanged.sql", Checksum: checksum(fsys["R_unchanged.sql"].Data)},
+	}
+
+	got, err := migration.pending(available, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_213554_create_log.sql", "R_timestamp_created.sql", "R_users_view.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pending()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// applied repeatable migrations are never out of order
+	records = append(records, Record{Migration: "2019_03_05_213554_create_log.sql"})
+	got, err = migration.pending(available, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"R_timestamp_created.sql", "R_users_view.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pending()\ngot  %v\nwant %v\n", got, want)
+	}
+}
+
+func TestApplyRepeatable(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"2019_03_05_173612_create_users.sql": `CREATE TABLE users (id INT);`,
+		"R_users_view.sql":                   `CREATE OR REPLACE VIEW user_ids AS SELECT id FROM users;`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := New(dir).Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql", "R_users_view.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// unchanged repeatable migrations are skipped
+	got, err = New(dir).Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// changed repeatable migrations run again after new versioned migrations
+	files = map[string]string{
+		"2019_03_06_000000_add_name.sql": `ALTER TABLE users ADD COLUMN name TEXT;`,
+		"R_users_view.sql":               `CREATE OR REPLACE VIEW user_ids AS SELECT id, name FROM users;`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = New(dir).Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"2019_03_06_000000_add_name.sql", "R_users_view.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	records, err := New(dir).History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(records); !reflect.DeepEqual(got, []string{"2019_03_05_173612_create_users.sql", "2019_03_06_000000_add_name.sql", "R_users_view.sql"}) {
+		t.Errorf("History() should keep a single entry per repeatable migration, got %v", got)
+	}
+	if err := New(dir).Verify(ctx, database); err != nil {
+		t.Errorf("Verify() should skip repeatable migrations: %v", err)
+	}
+}
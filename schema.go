@@ -0,0 +1,72 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// quoteIdent quotes an identifier (e.g. a table name) for use in SQL.
+//
+// Embedded double quotes are escaped by doubling them.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// historyTable returns the quoted and possibly schema-qualified name of the
+// history table.
+func (m *Migration) historyTable() string {
+	if m.historySchema == "" {
+		return quoteIdent(m.table)
+	}
+	return quoteIdent(m.historySchema) + "." + quoteIdent(m.table)
+}
+
+// auditTable returns the quoted and possibly schema-qualified name of the
+// audit table, which lives next to the history table.
+func (m *Migration) auditTable() string {
+	if m.historySchema == "" {
+		return quoteIdent(m.table + "_audit")
+	}
+	return quoteIdent(m.historySchema) + "." + quoteIdent(m.table+"_audit")
+}
+
+// useSchema creates the target schema if needed and sets the search_path of
+// the session to it.
+func (m *Migration) useSchema(ctx context.Context, conn *sql.Conn) error {
+	if err := createSchema(ctx, conn, m.schema); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT set_config('search_path', $1, false);`, quoteIdent(m.schema)); err != nil {
+		return &DriverError{"failed to set search_path to schema " + m.schema, err}
+	}
+	return nil
+}
+
+// createSchema creates the schema unless it exists.
+//
+// The existence is checked beforehand, as CREATE SCHEMA IF NOT EXISTS
+// requires the CREATE privilege on the database even for existing schemas.
+func createSchema(ctx context.Context, db queryer, name string) error {
+	var exist bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1);`, name).Scan(&exist); err != nil {
+		return &DriverError{"failed to verify existence of schema " + name, err}
+	}
+	if exist {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+quoteIdent(name)+";"); err != nil {
+		return &DriverError{"failed to create schema " + name, err}
+	}
+	return nil
+}
+
+// resetSchema resets the search_path of the session set by useSchema.
+//
+// The search_path is reset even if the migration context was canceled: a
+// pooled connection must not keep it.
+func (m *Migration) resetSchema(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), `RESET search_path;`); err != nil {
+		m.logger("failed to reset search_path: " + err.Error())
+	}
+}
@@ -0,0 +1,83 @@
+package migrathor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_quoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"migrations":  `"migrations"`,
+		"Migrations":  `"Migrations"`,
+		`schema"name`: `"schema""name"`,
+	}
+	for name, want := range tests {
+		if got := quoteIdent(name); got != want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestMigration_historyTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{name: "default", want: `"migrations"`},
+		{name: "table", options: []Option{WithHistoryTable("history")}, want: `"history"`},
+		{name: "qualified", options: []Option{WithHistoryTable("meta.history")}, want: `"meta"."history"`},
+		{name: "schema", options: []Option{WithSchema("app")}, want: `"app"."migrations"`},
+		{name: "schema and qualified", options: []Option{WithSchema("app"), WithHistoryTable("meta.history")}, want: `"meta"."history"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New("testdata", tt.options...).historyTable(); got != tt.want {
+				t.Errorf("historyTable() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySchema(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+	defer func() {
+		if _, err := database.ExecContext(ctx, `DROP SCHEMA IF EXISTS app CASCADE; DROP SCHEMA IF EXISTS meta CASCADE;`); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	migration := New("testdata", WithSchema("app"), WithHistoryTable("meta.migrations"))
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	// migrations ran in target schema, history was kept in its own schema
+	var tables int
+	cmd := `SELECT count(*) FROM pg_tables WHERE (schemaname, tablename) IN (('app', 'users'), ('meta', 'migrations'));`
+	if err := database.QueryRowContext(ctx, cmd).Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 2 {
+		t.Errorf("expected tables app.users and meta.migrations, found %d of them", tables)
+	}
+
+	// pooled connections must not keep the search_path
+	var searchPath string
+	if err := database.QueryRowContext(ctx, `SHOW search_path;`).Scan(&searchPath); err != nil {
+		t.Fatal(err)
+	}
+	if searchPath == `"app"` || searchPath == "app" {
+		t.Errorf("search_path was not reset: %s", searchPath)
+	}
+}
@@ -0,0 +1,151 @@
+package migrathor
+
+import "strings"
+
+// statement is a single SQL statement of a migration.
+type statement struct {
+	sql       string
+	startLine int // line of the first token (1-based)
+	endLine   int // line of the terminating semicolon or last token
+	offset    int // byte offset of the statement within the script
+}
+
+// splitStatements splits the SQL script into its statements.
+//
+// Statements are terminated by semicolons outside of comments, string
+// literals, quoted identifiers and dollar-quoted strings. Comments between
+// statements are dropped, empty statements are skipped. Function bodies
+// using BEGIN ATOMIC aren't supported and must be dollar-quoted.
+func splitStatements(script string) []statement {
+	statements := []statement{}
+	start, startLine := -1, 0 // first token of the current statement
+	last, lastLine := -1, 0   // last token of the current statement
+	line := 1
+
+	// skip advances i to end and counts the lines in between.
+	skip := func(i, end int) int {
+		if end > len(script) {
+			end = len(script)
+		}
+		line += strings.Count(script[i:end], "\n")
+		return end
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end
+			continue
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skip(i, i+blockComment(script[i:]))
+			continue
+		}
+
+		if start < 0 {
+			start, startLine = i, line
+		}
+		switch {
+		case c == '\'':
+			escapes := i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') && (i == 1 || !identChar(script[i-2]))
+			i = skip(i, i+quoted(script[i:], '\'', escapes))
+		case c == '"':
+			i = skip(i, i+quoted(script[i:], '"', false))
+		case c == '$' && (i == 0 || !identChar(script[i-1])):
+			if tag := dollarTag(script[i:]); tag != "" {
+				end := strings.Index(script[i+len(tag):], tag)
+				if end < 0 {
+					i = skip(i, len(script))
+				} else {
+					i = skip(i, i+len(tag)+end+len(tag))
+				}
+			} else {
+				i++
+			}
+		case c == ';':
+			if start < i {
+				statements = append(statements, statement{script[start : i+1], startLine, line, start})
+			}
+			start = -1
+			i++
+			continue
+		default:
+			i++
+		}
+		last, lastLine = i, line
+	}
+
+	if start >= 0 {
+		statements = append(statements, statement{script[start:last], startLine, lastLine, start})
+	}
+	return statements
+}
+
+// blockComment returns the length of the (possibly nested) block comment at
+// the start of s.
+func blockComment(s string) int {
+	depth := 0
+	for i := 0; i < len(s)-1; i++ {
+		switch {
+		case s[i] == '/' && s[i+1] == '*':
+			depth++
+			i++
+		case s[i] == '*' && s[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// quoted returns the length of the quoted string at the start of s. Doubled
+// quotes are part of the string, so are quotes escaped by backslash if
+// escapes is set.
+func quoted(s string, quote byte, escapes bool) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case escapes && s[i] == '\\':
+			i++
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// dollarTag returns the opening tag of the dollar-quoted string at the start
+// of s, e.g. $$ or $body$, or an empty string for anything else like the
+// parameter $1.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case identChar(s[i]) && !(i == 1 && s[i] >= '0' && s[i] <= '9'):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// identChar returns whether c may be part of an unquoted identifier.
+func identChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
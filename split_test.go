@@ -0,0 +1,73 @@
+package migrathor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_splitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []statement
+	}{
+		{
+			name:   "simple",
+			script: "CREATE TABLE a ();\nCREATE TABLE b ();\n",
+			want: []statement{
+				{"CREATE TABLE a ();", 1, 1, 0},
+				{"CREATE TABLE b ();", 2, 2, 19},
+			},
+		},
+		{
+			name:   "multi-line without trailing semicolon",
+			script: "-- migrathor:no_transaction\n\nCREATE INDEX CONCURRENTLY a_idx\n\tON a (id);\nVACUUM a\n",
+			want: []statement{
+				{"CREATE INDEX CONCURRENTLY a_idx\n\tON a (id);", 3, 4, 29},
+				{"VACUUM a", 5, 5, 73},
+			},
+		},
+		{
+			name:   "comments",
+			script: "/* header; /* nested; */ still comment; */\nSELECT 1; -- trailing; comment\n-- only; comment\nSELECT /* inline; */ 2;",
+			want: []statement{
+				{"SELECT 1;", 2, 2, 43},
+				{"SELECT /* inline; */ 2;", 4, 4, 91},
+			},
+		},
+		{
+			name:   "string literals",
+			script: "INSERT INTO a VALUES ('it''s; fine', E'esc\\'; aped', \"semi;colon\");\nSELECT 'multi\nline;';",
+			want: []statement{
+				{"INSERT INTO a VALUES ('it''s; fine', E'esc\\'; aped', \"semi;colon\");", 1, 1, 0},
+				{"SELECT 'multi\nline;';", 2, 3, 68},
+			},
+		},
+		{
+			name:   "dollar quoting",
+			script: "CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n\tRETURN NEW; -- $$;\nEND;\n$body$ LANGUAGE plpgsql;\nDO $$ BEGIN PERFORM 1; END $$;\nPREPARE p AS SELECT $1;",
+			want: []statement{
+				{"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n\tRETURN NEW; -- $$;\nEND;\n$body$ LANGUAGE plpgsql;", 1, 5, 0},
+				{"DO $$ BEGIN PERFORM 1; END $$;", 6, 6, 102},
+				{"PREPARE p AS SELECT $1;", 7, 7, 133},
+			},
+		},
+		{
+			name:   "empty statements",
+			script: ";\n ; -- nothing\n",
+			want:   []statement{},
+		},
+		{
+			name:   "no statements",
+			script: "-- migrathor:no_transaction\n/* nothing */\n",
+			want:   []statement{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements()\ngot  %q\nwant %q\n", got, tt.want)
+			}
+		})
+	}
+}
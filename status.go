@@ -0,0 +1,135 @@
+package migrathor
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// State describes whether a migration has been applied to the database.
+type State int
+
+const (
+	// StatePending marks an available migration which was not applied yet.
+	StatePending State = iota
+	// StateApplied marks an available migration which was already applied.
+	StateApplied
+	// StateMissing marks an applied migration which is not available anymore.
+	StateMissing
+	// StateDirty marks a migration without transaction support which failed
+	// or is still running (see Resolve).
+	StateDirty
+	// StateSkipped marks an available migration which is not selected by
+	// the active tags (see WithTags).
+	StateSkipped
+)
+
+func (s State) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateApplied:
+		return "applied"
+	case StateMissing:
+		return "missing"
+	case StateDirty:
+		return "dirty"
+	case StateSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// MigrationStatus describes the state of a single migration.
+type MigrationStatus struct {
+	// Migration is the filename of the migration.
+	Migration string
+
+	// State tells whether the migration is pending, applied, missing, dirty
+	// or skipped.
+	State State
+
+	// AppliedAt is the time of the last execution (zero if not applied).
+	AppliedAt time.Time
+
+	// ExecutionTime is the duration of execution (zero if not applied).
+	ExecutionTime time.Duration
+
+	// OutOfOrder marks a pending migration which is older than the latest
+	// applied migration.
+	OutOfOrder bool
+}
+
+// Status returns the state of every available and every applied migration
+// sorted by migration name with repeatable migrations last.
+//
+// Repeatable migrations whose contents changed since their last execution
+// are pending again and keep the time of their last execution.
+//
+// Status is read-only: the database schema is left untouched and a missing
+// history table is treated as if no migration was applied yet.
+func (m *Migration) Status(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	run, available, err := m.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := m.historyIfExists(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	outdated, err := run.outdated(available, records)
+	if err != nil {
+		return nil, err
+	}
+	pending := filterExcept(available, names(records))
+	skipped, err := run.skipped(append(pending, outdated...))
+	if err != nil {
+		return nil, err
+	}
+	outdated = filterExcept(outdated, skipped)
+
+	status := []MigrationStatus{}
+	for _, r := range records {
+		s := MigrationStatus{
+			Migration:     r.Migration,
+			State:         StateMissing,
+			AppliedAt:     r.AppliedAt,
+			ExecutionTime: r.ExecutionTime,
+		}
+		if len(filterExcept([]string{r.Migration}, available)) == 0 {
+			s.State = StateApplied
+		}
+		if len(filterExcept([]string{r.Migration}, outdated)) == 0 {
+			s.State = StatePending // repeatable migration changed since
+		}
+		if r.Dirty {
+			s.State = StateDirty
+		}
+		status = append(status, s)
+	}
+	late := outOfOrder(versioned(filterExcept(pending, skipped)), records)
+	for _, migration := range pending {
+		s := MigrationStatus{
+			Migration:  migration,
+			State:      StatePending,
+			OutOfOrder: len(filterExcept([]string{migration}, late)) == 0,
+		}
+		if len(filterExcept([]string{migration}, skipped)) == 0 {
+			s.State = StateSkipped
+		}
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		ri, rj := repeatable(status[i].Migration), repeatable(status[j].Migration)
+		if ri != rj {
+			return rj // repeatable migrations are executed last
+		}
+		return status[i].Migration < status[j].Migration
+	})
+
+	return status, nil
+}
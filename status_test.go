@@ -0,0 +1,78 @@
+package migrathor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestState_String(t *testing.T) {
+	tests := map[State]string{
+		StatePending: "pending",
+		StateApplied: "applied",
+		StateMissing: "missing",
+		StateDirty:   "dirty",
+		StateSkipped: "skipped",
+		State(42):    "unknown",
+	}
+	for state, want := range tests {
+		if got := state.String(); got != want {
+			t.Errorf("State(%d).String() = %q, want %q", state, got, want)
+		}
+	}
+}
+
+func TestMigration_Status(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+
+	// status must not create the history table
+	status, err := migration.Status(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []State{}
+	for _, s := range status {
+		got = append(got, s.State)
+	}
+	want := []State{StatePending, StatePending}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Status()\ngot  %v\nwant %v\n", got, want)
+	}
+	exist, err := migration.initialized(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Fatal("history table shouldn't exist but does")
+	}
+
+	if _, err := migration.Apply(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a deleted migration file
+	if _, err := database.ExecContext(ctx, `INSERT INTO migrations (migration, execution_time) VALUES ('2019_03_06_000000_deleted.sql', 0);`); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = migration.Status(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = []State{}
+	for _, s := range status {
+		got = append(got, s.State)
+		if s.AppliedAt.IsZero() {
+			t.Errorf("Status(): applied migration %s has no applied_at", s.Migration)
+		}
+	}
+	want = []State{StateApplied, StateApplied, StateMissing}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Status()\ngot  %v\nwant %v\n", got, want)
+	}
+}
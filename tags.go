@@ -0,0 +1,64 @@
+package migrathor
+
+import "strings"
+
+// selected returns whether a migration with the tags is selected by the
+// active tags (see WithTags).
+//
+// Migrations without tags are always selected. Migrations carrying a negated
+// tag like !seed are skipped. If any tag is active, tagged migrations are
+// only selected if they carry one of the active tags.
+func (m *Migration) selected(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	include, matched := false, false
+	for _, active := range m.tags {
+		if strings.HasPrefix(active, "!") {
+			if hasTag(tags, active[1:]) {
+				return false
+			}
+			continue
+		}
+		include = true
+		if hasTag(tags, active) {
+			matched = true
+		}
+	}
+	return !include || matched
+}
+
+// hasTag returns whether tags contains tag (case-insensitive).
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped returns all migrations which aren't selected by the active tags.
+func (m *Migration) skipped(migrations []string) ([]string, error) {
+	skipped := []string{}
+	if len(m.tags) == 0 {
+		return skipped, nil
+	}
+	for _, migration := range migrations {
+		if _, ok := m.registeredFunc(migration); ok {
+			continue // Go migrations carry no tags
+		}
+		buf, err := m.read(migration)
+		if err != nil {
+			return nil, err
+		}
+		directives, err := ParseDirectives(migration, buf)
+		if err != nil {
+			return nil, err
+		}
+		if !m.selected(directives.Tags) {
+			skipped = append(skipped, migration)
+		}
+	}
+	return skipped, nil
+}
@@ -0,0 +1,117 @@
+package migrathor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigration_selected(t *testing.T) {
+	tests := []struct {
+		active []string
+		tags   []string
+		want   bool
+	}{
+		{nil, nil, true},
+		{nil, []string{"dev", "staging"}, true},
+		{[]string{"prod"}, nil, true},
+		{[]string{"prod"}, []string{"dev", "staging"}, false},
+		{[]string{"dev"}, []string{"dev", "staging"}, true},
+		{[]string{"Staging"}, []string{"dev", "staging"}, true},
+		{[]string{"!seed"}, []string{"seed"}, false},
+		{[]string{"!seed"}, []string{"dev"}, true},
+		{[]string{"dev", "!seed"}, []string{"dev", "seed"}, false},
+	}
+	for _, tt := range tests {
+		migration := New("", WithTags(tt.active...))
+		if got := migration.selected(tt.tags); got != tt.want {
+			t.Errorf("selected(%v) with active tags %v = %t, want %t", tt.tags, tt.active, got, tt.want)
+		}
+	}
+}
+
+func TestMigration_pendingTags(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_create_users.sql": {Data: []byte("CREATE TABLE users ();")},
+		"2019_03_05_213554_add_users.sql":    {Data: []byte("-- migrathor:tags dev, staging\nINSERT INTO users DEFAULT VALUES;")},
+		"R_demo_view.sql":                    {Data: []byte("-- migrathor:tags demo\nCREATE OR REPLACE VIEW demo AS SELECT 1;")},
+	}
+	tests := map[string][]string{
+		"":          {"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql", "R_demo_view.sql"},
+		"prod":      {"2019_03_05_173612_create_users.sql"},
+		"staging":   {"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"},
+		"!demo":     {"2019_03_05_173612_create_users.sql", "2019_03_05_213554_add_users.sql"},
+		"demo,!dev": {"2019_03_05_173612_create_users.sql", "R_demo_view.sql"},
+	}
+	for active, want := range tests {
+		migration := NewFS(fsys)
+		if active != "" {
+			migration = NewFS(fsys, WithTags(strings.Split(active, ",")...))
+		}
+		available, err := migration.available()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := migration.pending(available, []Record{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pending() with tags %q\ngot  %v\nwant %v\n", active, got, want)
+		}
+	}
+}
+
+func TestApplyTags(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	dir, err := ioutil.TempDir("", "migrathor_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"2019_03_05_173612_create_users.sql": "CREATE TABLE users (name TEXT);",
+		"2019_03_05_213554_add_users.sql":    "-- migrathor:tags dev,staging\nINSERT INTO users VALUES ('Mike');",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migration := New(dir, WithTags("prod"))
+	got, err := migration.Apply(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2019_03_05_173612_create_users.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply()\ngot  %v\nwant %v\n", got, want)
+	}
+
+	status, err := migration.Status(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[1].State != StateSkipped {
+		t.Errorf("Status() should report skipped migration, got %v", status)
+	}
+
+	records, err := migration.History(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"prod"}; len(records) != 1 || !reflect.DeepEqual(records[0].Tags, want) {
+		t.Errorf("History() should record active tags %v, got %v", want, records)
+	}
+}
@@ -0,0 +1,66 @@
+package migrathor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// target limits the pending migrations to be applied in a single run.
+//
+// The zero value selects all pending migrations.
+type target struct {
+	migration string // last migration to apply (empty for all)
+	steps     int    // max number of migrations to apply (0 for all)
+}
+
+func targetMigration(migration string) target { return target{migration: migration} }
+
+func targetSteps(n int) target { return target{steps: n} }
+
+// limit returns the pending migrations selected by the target.
+func (t target) limit(pending []string, available []string, records []Record) ([]string, error) {
+	if t.migration != "" {
+		migration, err := resolve(t.migration, available)
+		if err != nil {
+			return nil, err
+		}
+		if len(filterExcept([]string{migration}, pending)) != 0 {
+			return nil, fmt.Errorf("target migration %q was already applied or is skipped by tags", migration)
+		}
+		for i, p := range pending {
+			if p == migration {
+				pending = pending[:i+1]
+				break
+			}
+		}
+	}
+	if t.steps > 0 && t.steps < len(pending) {
+		pending = pending[:t.steps]
+	}
+	return pending, nil
+}
+
+// resolve returns the available migration identified by name.
+//
+// The name matches a migration by its filename, its filename without
+// extension or an unambiguous prefix of its filename.
+func resolve(name string, available []string) (string, error) {
+	matches := filter(available, func(s string) bool {
+		s, name := strings.ToLower(s), strings.ToLower(name)
+		return s == name || strings.TrimSuffix(s, filepath.Ext(s)) == name
+	})
+	if len(matches) == 0 {
+		matches = filter(available, func(s string) bool {
+			return strings.HasPrefix(strings.ToLower(s), strings.ToLower(name))
+		})
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("target migration %q does not exist", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("target migration %q is ambiguous: matches %s", name, strings.Join(matches, ", "))
+}
@@ -0,0 +1,102 @@
+package migrathor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_resolve(t *testing.T) {
+	available := []string{
+		"2019_03_05_173612_create_users.sql",
+		"2019_03_05_213554_add_users.sql",
+		"2019_03_06_101010_create_log.sql",
+	}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "2019_03_05_213554_add_users.sql", want: "2019_03_05_213554_add_users.sql"},
+		{name: "2019_03_05_213554_ADD_USERS", want: "2019_03_05_213554_add_users.sql"},
+		{name: "2019_03_06", want: "2019_03_06_101010_create_log.sql"},
+		{name: "2019_03_05_173612", want: "2019_03_05_173612_create_users.sql"},
+		{name: "2019_03_05", wantErr: true},
+		{name: "2020", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolve(tt.name, available)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_target_limit(t *testing.T) {
+	available := []string{"1_a.sql", "2_b.sql", "3_c.sql", "4_d.sql", "R_view.sql"}
+	records := []Record{{Migration: "1_a.sql"}, {Migration: "R_view.sql"}}
+	pending := []string{"2_b.sql", "3_c.sql", "4_d.sql", "R_view.sql"}
+
+	tests := []struct {
+		name    string
+		target  target
+		want    []string
+		wantErr bool
+	}{
+		{name: "all", target: target{}, want: []string{"2_b.sql", "3_c.sql", "4_d.sql", "R_view.sql"}},
+		{name: "to", target: targetMigration("3"), want: []string{"2_b.sql", "3_c.sql"}},
+		{name: "to last", target: targetMigration("4_d"), want: []string{"2_b.sql", "3_c.sql", "4_d.sql"}},
+		{name: "to applied", target: targetMigration("1_a.sql"), wantErr: true},
+		{name: "to unknown", target: targetMigration("5"), wantErr: true},
+		{name: "steps", target: targetSteps(1), want: []string{"2_b.sql"}},
+		{name: "too many steps", target: targetSteps(10), want: []string{"2_b.sql", "3_c.sql", "4_d.sql", "R_view.sql"}},
+		{name: "to outdated repeatable", target: targetMigration("R_view"), want: []string{"2_b.sql", "3_c.sql", "4_d.sql", "R_view.sql"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.target.limit(pending, available, records)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("limit()\ngot  %v\nwant %v\n", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigration_ApplyTo(t *testing.T) {
+	if *flagWithDb == false {
+		t.Skip("skipping test: need a database")
+	}
+	ctx := context.Background()
+	defer cleanup(ctx, database, t)
+
+	migration := New("testdata")
+
+	got, err := migration.ApplyTo(ctx, database, "2019_03_05_173612")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2019_03_05_173612_create_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ApplyTo()\ngot  %v\nwant %v\n", got, want)
+	}
+	if _, err := migration.ApplyTo(ctx, database, "2019_03_05_173612"); err == nil {
+		t.Error("ApplyTo() should fail for applied target")
+	}
+
+	got, err = migration.ApplySteps(ctx, database, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"2019_03_05_213554_add_users.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplySteps()\ngot  %v\nwant %v\n", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package migrathor
+
+import (
+	"regexp"
+	"sort"
+)
+
+// placeholder matches the escape sequence "${$}" and variables like "${app_role}".
+//
+// "${" never occurs in valid SQL outside of literals, whereas "$$" starts a
+// dollar-quoted string and must be left alone, e.g. in $${"a":1}$$::jsonb.
+var placeholder = regexp.MustCompile(`\$\{\$\}|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substitute replaces all variables in the contents of migration with their
+// values. The escape sequence "${$}" is replaced by a literal "$", so
+// "${$}{app_role}" yields "${app_role}".
+func (m *Migration) substitute(migration, contents string) (string, error) {
+	undefined := map[string]bool{}
+	result := placeholder.ReplaceAllStringFunc(contents, func(s string) string {
+		if s == "${$}" {
+			return "$"
+		}
+		name := s[2 : len(s)-1]
+		value, ok := m.variables[name]
+		if !ok {
+			undefined[name] = true
+			return s
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		names := []string{}
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", &VariableError{Migration: migration, Variables: names}
+	}
+	return result, nil
+}
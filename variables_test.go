@@ -0,0 +1,70 @@
+package migrathor
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigration_substitute(t *testing.T) {
+	migration := New("", WithVariables(map[string]string{"app_role": "app", "Space": "fast"}))
+
+	tests := []struct {
+		contents string
+		want     string
+	}{
+		{"GRANT SELECT ON users TO ${app_role};", "GRANT SELECT ON users TO app;"},
+		{"CREATE TABLE t (id INT) TABLESPACE ${Space}; -- ${app_role}", "CREATE TABLE t (id INT) TABLESPACE fast; -- app"},
+		{"SELECT '${$}{app_role}';", "SELECT '${app_role}';"},
+		{"SELECT $$${app_role}$$;", "SELECT $$app$$;"},
+		{`SELECT $${"a":1}$$::jsonb;`, `SELECT $${"a":1}$$::jsonb;`},
+		{"SELECT $tag$ ${app_role} $tag$;", "SELECT $tag$ app $tag$;"},
+		{"SELECT $$ dollar $$, '${', '${ app_role }';", "SELECT $$ dollar $$, '${', '${ app_role }';"},
+	}
+	for _, tt := range tests {
+		got, err := migration.substitute("test.sql", tt.contents)
+		if err != nil {
+			t.Errorf("substitute(%q) failed: %v", tt.contents, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("substitute(%q)\ngot  %q\nwant %q\n", tt.contents, got, tt.want)
+		}
+	}
+
+	_, err := migration.substitute("test.sql", "GRANT ${privilege} ON ${table} TO ${app_role}; -- ${table}")
+	verr, ok := err.(*VariableError)
+	if !ok {
+		t.Fatalf("substitute() should fail with VariableError, got %v", err)
+	}
+	want := &VariableError{Migration: "test.sql", Variables: []string{"privilege", "table"}}
+	if !reflect.DeepEqual(verr, want) {
+		t.Errorf("substitute()\ngot  %v\nwant %v\n", verr, want)
+	}
+}
+
+func TestMigration_planVariables(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2019_03_05_173612_grant.sql": {Data: []byte("GRANT SELECT ON users TO ${app_role};")},
+		"2019_03_05_213554_owner.sql": {Data: []byte("ALTER TABLE users OWNER TO ${owner};")},
+	}
+	migration := NewFS(fsys, WithVariables(map[string]string{"app_role": "app"}), WithVariables(map[string]string{"owner": "admin"}))
+
+	steps, err := migration.plan([]string{"2019_03_05_173612_grant.sql", "2019_03_05_213554_owner.sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "GRANT SELECT ON users TO app;"; steps[0].SQL != want {
+		t.Errorf("plan()\ngot  %q\nwant %q\n", steps[0].SQL, want)
+	}
+	// checksum of raw file: values may differ between databases
+	if want := checksum(fsys["2019_03_05_173612_grant.sql"].Data); steps[0].checksum != want {
+		t.Errorf("plan() checksum\ngot  %q\nwant %q\n", steps[0].checksum, want)
+	}
+
+	// undefined variable in the last migration fails the whole plan
+	migration = NewFS(fsys, WithVariables(map[string]string{"app_role": "app"}))
+	if _, err := migration.plan([]string{"2019_03_05_173612_grant.sql", "2019_03_05_213554_owner.sql"}); err == nil {
+		t.Error("plan() should fail for undefined variables")
+	}
+}